@@ -0,0 +1,220 @@
+// Command humble runs humble lisp files or a REPL
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"humble"
+)
+
+const (
+	prompt     = "» "
+	contPrompt = "… " // expression continues on next line
+)
+
+// promptReader prints a prompt to w before reading each line from r
+type promptReader struct {
+	r       *bufio.Reader
+	w       io.Writer
+	prompt  func() string
+	pending []byte
+}
+
+func (p *promptReader) Read(buf []byte) (int, error) {
+	if len(p.pending) == 0 {
+		fmt.Fprint(p.w, p.prompt())
+		line, err := p.r.ReadBytes('\n')
+		if len(line) == 0 {
+			return 0, err
+		}
+		p.pending = line
+	}
+
+	n := copy(buf, p.pending)
+	p.pending = p.pending[n:]
+	return n, nil
+}
+
+// repl reads expressions from r, evaluates them and prints the results to w.
+// Expressions may span several lines, and a line may hold several expressions.
+func repl(interp *humble.Interpreter, r io.Reader, w io.Writer) {
+	var rdr *humble.Reader
+	pr := &promptReader{
+		r: bufio.NewReader(r),
+		w: w,
+		prompt: func() string {
+			if rdr.Depth() > 0 {
+				return contPrompt
+			}
+			return prompt
+		},
+	}
+	rdr = humble.NewReader(pr, "<stdin>")
+
+	for {
+		expr, err := rdr.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			printError(w, err)
+			// Drop rest of the line, it's probably garbage after the error
+			if err := rdr.SkipLine(); err != nil {
+				break
+			}
+			continue
+		}
+		//fmt.Printf("expr → %s\n", expr)
+
+		out, err := interp.EvalExpr(expr)
+		if err != nil {
+			printError(w, err)
+			continue
+		}
+		fmt.Fprintln(w, out)
+	}
+}
+
+// expand prints the code in r with all macros expanded. Definitions are
+// evaluated after they are printed so macros defined in r are used.
+func expand(interp *humble.Interpreter, r io.Reader, fileName string, w io.Writer) error {
+	rdr := humble.NewReader(r, fileName)
+	for {
+		expr, err := rdr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		out, err := interp.Expand(expr)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, out)
+
+		if !isDefinition(out) {
+			continue
+		}
+		if _, err := interp.EvalExpr(out); err != nil {
+			return err
+		}
+	}
+}
+
+// isDefinition returns true if expr is a top level definition
+func isDefinition(expr humble.Expression) bool {
+	le, ok := expr.(humble.ListExpr)
+	if !ok || len(le.Items) == 0 {
+		return false
+	}
+
+	op, ok := le.Items[0].(humble.SymbolExpr)
+	if !ok {
+		return false
+	}
+
+	switch op.Name {
+	case "define", "define-syntax", "defmacro":
+		return true
+	}
+	return false
+}
+
+func expandPath(interp *humble.Interpreter, fileName string) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return expand(interp, file, fileName, os.Stdout)
+}
+
+// printError prints err to w, with a traceback if it has one
+func printError(w io.Writer, err error) {
+	msg := err.Error()
+	var herr *humble.Error
+	if errors.As(err, &herr) {
+		msg = herr.Traceback()
+	}
+	fmt.Fprintf(w, "\033[31mERROR: %s\033[0m\n", msg)
+}
+
+// isTerminal returns true if file is a terminal (and not a pipe or a file)
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// rlwrap go run ./cmd/humble
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [-expand] [FILE]\n", path.Base(os.Args[0]))
+		fmt.Fprintln(os.Stderr, "Without a file will invoke REPL, or read piped input.")
+		fmt.Fprintln(os.Stderr, "Use - as FILE to read from standard input.")
+		flag.PrintDefaults()
+	}
+	expandMode := flag.Bool("expand", false, "print FILE with macros expanded")
+	flag.Parse()
+
+	interp := humble.New()
+	if *expandMode {
+		if flag.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "error: -expand requires a file.")
+			os.Exit(1)
+		}
+
+		var err error
+		if flag.Arg(0) == "-" {
+			err = expand(interp, os.Stdin, "<stdin>", os.Stdout)
+		} else {
+			err = expandPath(interp, flag.Arg(0))
+		}
+		if err != nil {
+			printError(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	switch flag.NArg() {
+	case 0:
+		if !isTerminal(os.Stdin) {
+			if _, err := interp.EvalReader(os.Stdin); err != nil {
+				printError(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		fmt.Println("Welcome to Hubmle lisp (hit CTRL-D to quit)")
+		repl(interp, os.Stdin, os.Stdout)
+		fmt.Println("\nkthxbai ☺")
+	case 1:
+		var err error
+		if flag.Arg(0) == "-" {
+			_, err = interp.EvalReader(os.Stdin)
+		} else {
+			_, err = interp.Load(flag.Arg(0))
+		}
+		if err != nil {
+			printError(os.Stderr, err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "error: wrong number of arguments.")
+		os.Exit(1)
+	}
+}
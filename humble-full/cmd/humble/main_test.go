@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"humble"
+)
+
+func TestREPL(t *testing.T) {
+	in := "(define x\n  2) (+ x 1)\n\n(* x\n\n 3))\n(+ x 4)\n(+ x y)\n(car 1) 7\n"
+	var out strings.Builder
+	repl(humble.New(), strings.NewReader(in), &out)
+
+	expected := "» … 2\n3\n» » … … 6\n" +
+		"\033[31mERROR: <stdin>:6:4: unexpected ')' without matching '('\033[0m\n" +
+		"» 6\n" +
+		"» \033[31mERROR: <stdin>:8:6: unknown name - y\033[0m\n" +
+		"» \033[31mERROR: <stdin>:9:1: car - argument 0: got 1 of type humble.Integer\033[0m\n" +
+		"7\n" +
+		"» "
+	if out.String() != expected {
+		t.Fatalf("output mismatch: %q != %q", out.String(), expected)
+	}
+}
+
+var expandRoundTripTestCases = []struct {
+	name string
+	code string
+	out  string
+}{
+	{"defmacro", `
+(defmacro swap! (a b)
+  (let ((tmp (gensym)))
+    ` + "`" + `(let ((,tmp ,a)) (set! ,a ,b) (set! ,b ,tmp))))
+(define x 1)
+(define y 2)
+(swap! x y)
+(list x y)
+`, "(2 1)"},
+	{"syntax-rules", `
+(define-syntax swap!
+  (syntax-rules ()
+    ((_ a b) (let ((tmp a)) (set! a b) (set! b tmp)))))
+(define-syntax my-or
+  (syntax-rules ()
+    ((_) #f)
+    ((_ e) e)
+    ((_ e r ...) (let ((tmp e)) (if tmp tmp (my-or r ...))))))
+(define tmp 1)
+(define y 2)
+(swap! tmp y)
+(list tmp y (my-or #f tmp) (my-or #f #f))
+`, "(2 1 2 #f)"},
+}
+
+func TestExpandRoundTrip(t *testing.T) {
+	for _, tc := range expandRoundTripTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var expanded strings.Builder
+			if err := expand(humble.New(), strings.NewReader(tc.code), "<test>", &expanded); err != nil {
+				t.Fatal(err)
+			}
+
+			// Expanded code should read back and evaluate without the macros
+			out, err := humble.New().Eval(expanded.String())
+			if err != nil {
+				t.Fatalf("eval expanded code: %s\n%s", err, expanded.String())
+			}
+
+			if s := fmt.Sprint(out); s != tc.out {
+				t.Fatalf("result mismatch: %s != %s\n%s", tc.out, s, expanded.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package humble
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Continuation is an escaping continuation created by call/cc. Calling it
+// returns its argument from the call/cc that created it. Continuations can't be
+// called after that call/cc returned (they are not re-entrant).
+type Continuation struct {
+	done bool
+}
+
+func (k *Continuation) String() string {
+	return "#<continuation>"
+}
+
+// Call implements Callable, it returns an *escape error that unwinds the stack
+// up to the call/cc that created k.
+func (k *Continuation) Call(args []Object) (Object, error) {
+	if k.done {
+		return nil, fmt.Errorf("continuation called after its call/cc returned (re-entry is not supported)")
+	}
+
+	var val Object
+	switch len(args) {
+	case 0:
+		val = Boolean(false) // unspecified
+	case 1:
+		val = args[0]
+	default:
+		val = NewList(args...)
+	}
+
+	return nil, &escape{k, val}
+}
+
+// escape is returned as an error when a continuation is called, it's caught by
+// the call/cc that created the continuation.
+type escape struct {
+	k     *Continuation
+	value Object
+}
+
+func (e *escape) Error() string {
+	return "continuation called outside of call/cc"
+}
+
+// callCC calls proc with the current continuation
+func callCC(args []Object) (Object, error) {
+	proc, ok := args[0].(Callable)
+	if !ok {
+		return nil, argError(args, 0)
+	}
+
+	k := &Continuation{}
+	defer func() { k.done = true }()
+
+	out, err := proc.Call([]Object{k})
+	var esc *escape
+	if errors.As(err, &esc) && esc.k == k {
+		return esc.value, nil
+	}
+	return out, err
+}
+
+// dynamicWind calls before, thunk and after. after is called when thunk
+// returns, fails or escapes with a continuation.
+func dynamicWind(args []Object) (Object, error) {
+	procs := make([]Callable, len(args))
+	for i, arg := range args {
+		proc, ok := arg.(Callable)
+		if !ok {
+			return nil, argError(args, i)
+		}
+		procs[i] = proc
+	}
+	before, thunk, after := procs[0], procs[1], procs[2]
+
+	if _, err := before.Call(nil); err != nil {
+		return nil, err
+	}
+
+	out, err := thunk.Call(nil)
+	if _, aerr := after.Call(nil); aerr != nil && err == nil {
+		return nil, aerr
+	}
+	return out, err
+}
+
+func init() {
+	m := map[Symbol]Object{
+		// (call/cc (lambda (return) (return 1) 2)) → 1
+		"call-with-current-continuation": &Function{"call-with-current-continuation", 1, 1, callCC},
+		"call/cc":                        &Function{"call/cc", 1, 1, callCC},
+		// (dynamic-wind (lambda () (print "in")) thunk (lambda () (print "out")))
+		"dynamic-wind": &Function{"dynamic-wind", 3, 3, dynamicWind},
+	}
+
+	for name, obj := range m {
+		builtins.Set(name, obj)
+	}
+}
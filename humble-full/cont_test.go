@@ -0,0 +1,77 @@
+package humble
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var contTestCases = []struct {
+	code string
+	out  string
+}{
+	{"(call/cc (lambda (k) 1))", "1"},
+	{"(+ 1 (call/cc (lambda (k) (+ 10 (k 2)))))", "3"},
+	{"(call-with-current-continuation (lambda (k) (k)))", "#f"},
+	// Early exit from a loop
+	{`(define (find-first pred lst)
+	    (call/cc
+	      (lambda (return)
+	        (let loop ((lst lst))
+	          (cond ((null? lst) #f)
+	                ((pred (car lst)) (return (car lst)))
+	                (else (loop (cdr lst))))))))
+	  (find-first (lambda (x) (< 2 x)) '(1 2 3 4))`, "3"},
+	// Escape through nested call/cc
+	{"(call/cc (lambda (outer) (call/cc (lambda (inner) (outer 'out))) 'after))", "out"},
+	{"(call/cc (lambda (outer) (list (call/cc (lambda (inner) (inner 'in))) 'after)))", "(in after)"},
+	// Escape through builtins
+	{"(call/cc (lambda (k) (dynamic-wind (lambda () 1) (lambda () (k 'escaped)) (lambda () 3))))", "escaped"},
+	// dynamic-wind
+	{`(define trace '())
+	  (define (log x) (set! trace (cons x trace)))
+	  (call/cc (lambda (k)
+	    (dynamic-wind
+	      (lambda () (log 'before))
+	      (lambda () (log 'during) (k 'exit) (log 'not-here))
+	      (lambda () (log 'after)))))
+	  (reverse trace)`, "(before during after)"},
+	{"(dynamic-wind (lambda () 1) (lambda () 2) (lambda () 3))", "2"},
+	{"(procedure? (call/cc (lambda (k) k)))", "#t"},
+}
+
+func TestContinuations(t *testing.T) {
+	for _, tc := range contTestCases {
+		t.Run(tc.code, func(t *testing.T) {
+			out := fmt.Sprint(run(t, New(), tc.code))
+			if tc.out != out {
+				t.Fatalf("result mismatch: %s != %s", tc.out, out)
+			}
+		})
+	}
+}
+
+var contErrorTestCases = []struct {
+	code string
+	err  string
+}{
+	{"(define k (call/cc (lambda (k) k)))\n(k 1)", "<test>:2:1: continuation called after its call/cc returned (re-entry is not supported)"},
+	{"(call/cc 1)", "<test>:1:1: call/cc - argument 0: got 1 of type humble.Integer"},
+	{"(define x 0)\n(dynamic-wind (lambda () 1) (lambda () (car 1)) (lambda () (set! x 1)))", "<test>:2:40: car - argument 0: got 1 of type humble.Integer"},
+}
+
+func TestContinuationErrors(t *testing.T) {
+	for _, tc := range contErrorTestCases {
+		t.Run(tc.code, func(t *testing.T) {
+			interp := New()
+			_, err := interp.eval(strings.NewReader(tc.code), "<test>")
+			if err == nil {
+				t.Fatal("no error")
+			}
+
+			if err.Error() != tc.err {
+				t.Fatalf("error mismatch: %q != %q", err.Error(), tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package humble
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrorObject is an error condition, created by error or by builtins.
+// e.g. (error "bad row" 3)
+type ErrorObject struct {
+	Message   string
+	Irritants []Object
+}
+
+func (e *ErrorObject) Error() string {
+	if len(e.Irritants) == 0 {
+		return e.Message
+	}
+
+	irritants := make([]string, len(e.Irritants))
+	for i, obj := range e.Irritants {
+		irritants[i] = fmt.Sprint(obj)
+	}
+	return fmt.Sprintf("%s - %s", e.Message, strings.Join(irritants, " "))
+}
+
+func (e *ErrorObject) String() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "#<error %s", String(e.Message))
+	for _, obj := range e.Irritants {
+		fmt.Fprintf(&buf, " %v", obj)
+	}
+	buf.WriteString(">")
+	return buf.String()
+}
+
+// raised is an object raised with raise, it is returned as an error until
+// it's caught by guard or with-exception-handler.
+type raised struct {
+	obj         Object
+	continuable bool
+}
+
+func (r *raised) Error() string {
+	if err, ok := r.obj.(error); ok {
+		return err.Error()
+	}
+	return fmt.Sprintf("uncaught exception - %v", r.obj)
+}
+
+// Unwrap returns the raised object if it's an error
+func (r *raised) Unwrap() error {
+	err, _ := r.obj.(error)
+	return err
+}
+
+// isCatchable returns true if err can be caught by exception handlers,
+// continuation escapes are not.
+func isCatchable(err error) bool {
+	var esc *escape
+	return err != nil && !errors.As(err, &esc)
+}
+
+// condition returns the object exception handlers get for err, it's the raised
+// object or an *ErrorObject for errors from builtins.
+func condition(err error) Object {
+	var r *raised
+	if errors.As(err, &r) {
+		return r.obj
+	}
+
+	var eo *ErrorObject
+	if errors.As(err, &eo) {
+		return eo
+	}
+
+	var perr *Error
+	if errors.As(err, &perr) { // drop the position from the message
+		err = perr.Err
+	}
+	return &ErrorObject{Message: err.Error()}
+}
+
+func errorObjectArg(args []Object, i int) (*ErrorObject, error) {
+	eo, ok := args[i].(*ErrorObject)
+	if !ok {
+		return nil, argError(args, i)
+	}
+	return eo, nil
+}
+
+func init() {
+	m := map[Symbol]Object{
+		"error-object?": &Function{"error-object?", 1, 1, func(args []Object) (Object, error) {
+			_, ok := args[0].(*ErrorObject)
+			return Boolean(ok), nil
+		}},
+		"error-object-message": &Function{"error-object-message", 1, 1, func(args []Object) (Object, error) {
+			eo, err := errorObjectArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return String(eo.Message), nil
+		}},
+		"error-object-irritants": &Function{"error-object-irritants", 1, 1, func(args []Object) (Object, error) {
+			eo, err := errorObjectArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return NewList(eo.Irritants...), nil
+		}},
+	}
+
+	for name, obj := range m {
+		builtins.Set(name, obj)
+	}
+}
+
+// exceptionBuiltins returns builtins that use the interpreter exception
+// handlers stack.
+func (i *Interpreter) exceptionBuiltins() map[Symbol]Object {
+	return map[Symbol]Object{
+		// (raise 'oops)
+		"raise": &Function{"raise", 1, 1, func(args []Object) (Object, error) {
+			return i.raise(args[0], false)
+		}},
+		// (error "bad row" 3) raises an error object with the message and
+		// irritants
+		"error": &Function{"error", 1, -1, func(args []Object) (Object, error) {
+			msg, err := stringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			return i.raise(&ErrorObject{Message: string(msg), Irritants: args[1:]}, false)
+		}},
+		// (raise-continuable obj) calls the current handler and returns its value
+		"raise-continuable": &Function{"raise-continuable", 1, 1, func(args []Object) (Object, error) {
+			return i.raise(args[0], true)
+		}},
+		// (with-exception-handler handler thunk)
+		"with-exception-handler": &Function{"with-exception-handler", 2, 2, i.withExceptionHandler},
+	}
+}
+
+// raise raises obj in the dynamic environment of the caller. The current
+// handler is called before unwinding, with the outer handlers installed. If
+// there's no handler or the current one is a guard, obj is returned as a
+// *raised error that unwinds to the guard.
+// A handler returning from a non continuable raise raises a secondary
+// exception to the outer handlers.
+func (i *Interpreter) raise(obj Object, continuable bool) (Object, error) {
+	if !i.hasHandler() {
+		return nil, &raised{obj: obj, continuable: continuable}
+	}
+
+	n := len(i.handlers)
+	handler := i.handlers[n-1]
+	i.handlers = i.handlers[:n-1]
+	defer func() { i.handlers = append(i.handlers, handler) }()
+
+	out, err := handler.Call([]Object{obj})
+	if err != nil || continuable {
+		return out, err
+	}
+
+	return i.raise(&ErrorObject{
+		Message:   "exception handler returned",
+		Irritants: []Object{obj},
+	}, false)
+}
+
+// hasHandler returns true if the current handler is not a guard
+func (i *Interpreter) hasHandler() bool {
+	n := len(i.handlers)
+	return n > 0 && i.handlers[n-1] != nil
+}
+
+// withExceptionHandler calls thunk with handler installed. Objects raised by
+// thunk are passed to handler by raise. Errors from builtins are passed to
+// handler after thunk returns, if handler returns the error is raised again to
+// outer handlers.
+func (i *Interpreter) withExceptionHandler(args []Object) (Object, error) {
+	handler, ok := args[0].(Callable)
+	if !ok {
+		return nil, argError(args, 0)
+	}
+
+	thunk, ok := args[1].(Callable)
+	if !ok {
+		return nil, argError(args, 1)
+	}
+
+	out, err := i.withHandler(handler, func() (Object, error) {
+		return thunk.Call(nil)
+	})
+	var r *raised
+	if !isCatchable(err) || errors.As(err, &r) { // raised objects were handled by raise
+		return out, err
+	}
+
+	if _, herr := handler.Call([]Object{condition(err)}); herr != nil {
+		return nil, herr
+	}
+
+	return i.raise(&ErrorObject{
+		Message:   "exception handler returned",
+		Irritants: []Object{condition(err)},
+	}, false)
+}
+
+// withHandler calls thunk with handler installed, a nil handler is a guard
+func (i *Interpreter) withHandler(handler Callable, thunk func() (Object, error)) (Object, error) {
+	n := len(i.handlers)
+	i.handlers = append(i.handlers, handler)
+	defer func() { i.handlers = i.handlers[:n] }()
+
+	return thunk()
+}
+
+// evalGuard evaluates (guard (var clause ...) body ...). If body raises, var
+// is bound to the condition and the clauses are evaluated like cond clauses. If
+// no clause matches the condition is raised again.
+func evalGuard(args []Expression, env *Environment) (Object, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("malformed guard")
+	}
+
+	spec, ok := args[0].(ListExpr)
+	if !ok || len(spec.Items) == 0 || spec.Tail != nil {
+		return nil, fmt.Errorf("malformed guard clauses - %s", args[0])
+	}
+
+	s, ok := spec.Items[0].(SymbolExpr)
+	if !ok {
+		return nil, fmt.Errorf("malformed guard variable - %s", spec.Items[0])
+	}
+
+	clauses, err := parseClauses(spec.Items[1:], env, "guard")
+	if err != nil {
+		return nil, err
+	}
+
+	body := func() (Object, error) {
+		return force(evalScopeBody(args[1:], NewEnvironment(env)))
+	}
+
+	i := env.interp
+	var out Object
+	if i != nil {
+		out, err = i.withHandler(nil, body)
+	} else {
+		out, err = body()
+	}
+	if !isCatchable(err) {
+		return out, err
+	}
+
+	condEnv := NewEnvironment(env)
+	condEnv.Set(s.Name, condition(err))
+	val, ok, cerr := evalClauses(clauses, condEnv, "guard")
+	if cerr != nil || ok {
+		return val, cerr
+	}
+
+	// Raise again to the outer handler, an outer guard gets the original error
+	var r *raised
+	if i != nil && i.hasHandler() && errors.As(err, &r) {
+		return i.raise(r.obj, r.continuable)
+	}
+	return nil, err
+}
@@ -0,0 +1,104 @@
+package humble
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var exceptionTestCases = []struct {
+	code string
+	out  string
+}{
+	{"(guard (e (#t (list 'caught e))) (raise 'oops))", "(caught oops)"},
+	{"(guard (e ((symbol? e) 'sym) ((string? e) 'str)) (raise \"x\"))", "str"},
+	{"(guard (e ((error-object? e) (error-object-message e))) (error \"bad row\" 3 'x))", `"bad row"`},
+	{"(guard (e ((error-object? e) (error-object-irritants e))) (error \"bad row\" 3 'x))", "(3 x)"},
+	{"(guard (e ((assoc 'a e) => cdr) (else 'other)) (raise (list (cons 'a 42))))", "42"},
+	{"(guard (e (else 'other)) 1)", "1"},
+	// Built-in errors
+	{"(guard (e (#t (error-object-message e))) (/ 1 0))", `"division by zero"`},
+	{"(guard (e (#t (error-object-message e))) (% 1 0))", `"division by zero"`},
+	{"(guard (e (#t (list (error-object-message e) (error-object-irritants e)))) undefined-x)", `("unknown name" (undefined-x))`},
+	{"(guard (e (#t (error-object-message e))) (-))", `"- - wrong number of arguments (want at least 1, got 0)"`},
+	{"(guard (e (#t (error-object-message e))) ((lambda (x) x)))", `"lambda - wrong number of arguments (want (lambda x), got 0)"`},
+	// Re-raise to outer guard when no clause matches
+	{"(guard (e ((string? e) 'outer)) (guard (e ((symbol? e) 'inner)) (raise \"s\")))", "outer"},
+	// Recover from bad rows
+	{`(define (parse row) (if (< row 0) (error "negative row" row) (* row 2)))
+	  (define (safe-parse row) (guard (e ((error-object? e) 'bad)) (parse row)))
+	  (list (safe-parse 1) (safe-parse -1) (safe-parse 3))`, "(2 bad 6)"},
+	// with-exception-handler
+	{"(with-exception-handler (lambda (e) 10) (lambda () (+ 1 (raise-continuable 'c))))", "11"},
+	{`(call/cc (lambda (k)
+	    (with-exception-handler
+	      (lambda (e) (k (list 'handled e)))
+	      (lambda () (raise 'boom)))))`, "(handled boom)"},
+	{`(call/cc (lambda (k)
+	    (with-exception-handler
+	      (lambda (e) (k (error-object-message e)))
+	      (lambda () (car 1)))))`, `"car - argument 0: got 1 of type humble.Integer"`},
+	// Handler is called with outer handlers installed
+	{`(with-exception-handler
+	    (lambda (e) (list 'outer e))
+	    (lambda ()
+	      (with-exception-handler
+	        (lambda (e) (raise-continuable (list 'inner e)))
+	        (lambda () (raise-continuable 'x)))))`, "(outer (inner x))"},
+	{"(guard (e (#t (error-object-message e))) (with-exception-handler (lambda (e) 0) (lambda () (raise 'x))))", `"exception handler returned"`},
+	// Handler is called at the point of raise, before unwinding
+	{`(define log '())
+	  (define r (call/cc (lambda (k)
+	    (with-exception-handler
+	      (lambda (e) (set! log (cons 'h log)) (k e))
+	      (lambda ()
+	        (dynamic-wind
+	          (lambda () #f)
+	          (lambda () (raise 1))
+	          (lambda () (set! log (cons 'after log)))))))))
+	  (append log (list r))`, "(after h 1)"},
+	{"(with-exception-handler (lambda (e) 'h) (lambda () (guard (e (#t 'g)) (raise 1))))", "g"},
+	{`(with-exception-handler
+	    (lambda (e) (list 'outer e))
+	    (lambda () (guard (e ((string? e) 'g)) (raise-continuable 1))))`, "(outer 1)"},
+	// Continuations are not caught by guard
+	{"(call/cc (lambda (k) (guard (e (#t 'caught)) (k 'escaped))))", "escaped"},
+}
+
+func TestExceptions(t *testing.T) {
+	for _, tc := range exceptionTestCases {
+		t.Run(tc.code, func(t *testing.T) {
+			out := fmt.Sprint(run(t, New(), tc.code))
+			if tc.out != out {
+				t.Fatalf("result mismatch: %s != %s", tc.out, out)
+			}
+		})
+	}
+}
+
+var exceptionErrorTestCases = []struct {
+	code string
+	err  string
+}{
+	{"(raise 'oops)", "<test>:1:1: uncaught exception - oops"},
+	{`(error "bad row" 3 "x")`, `<test>:1:1: bad row - 3 "x"`},
+	{"(guard (e ((string? e) 'str)) (raise 1))", "<test>:1:31: uncaught exception - 1"},
+	{"(raise-continuable 2)", "<test>:1:1: uncaught exception - 2"},
+	{"(guard e 1)", "<test>:1:1: malformed guard clauses - e"},
+	{"(error 1)", "<test>:1:1: error - argument 0: got 1 of type humble.Integer"},
+}
+
+func TestExceptionErrors(t *testing.T) {
+	for _, tc := range exceptionErrorTestCases {
+		t.Run(tc.code, func(t *testing.T) {
+			_, err := New().eval(strings.NewReader(tc.code), "<test>")
+			if err == nil {
+				t.Fatal("no error")
+			}
+
+			if err.Error() != tc.err {
+				t.Fatalf("error mismatch: %q != %q", err.Error(), tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,602 @@
+package humble
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+)
+
+// Register registers the Go function fn under name in the global environment.
+//
+// Lisp arguments are converted to the types of fn parameters: numbers to Go
+// numbers (integers must be whole and in range), strings to strings, booleans
+// to bool, lists to slices, association lists to maps and procedures to Go
+// functions. Any other parameter type gets the lisp object as is.
+//
+// If the last result of fn is an error and it's not nil, the call fails with
+// it. Other results are converted back to lisp objects, several results are
+// returned as a list.
+//
+// e.g.
+//
+//	interp.Register("repeat", strings.Repeat)
+func (i *Interpreter) Register(name string, fn any) error {
+	f, err := goFunction(name, fn)
+	if err != nil {
+		return err
+	}
+
+	i.env.Set(Symbol(name), f)
+	return nil
+}
+
+// Lookup returns the procedure defined as name in the global environment
+func (i *Interpreter) Lookup(name string) (Callable, error) {
+	env := i.env.Find(Symbol(name))
+	if env == nil {
+		return nil, fmt.Errorf("unknown name - %q", name)
+	}
+
+	obj := env.Get(Symbol(name))
+	c, ok := obj.(Callable)
+	if !ok {
+		return nil, fmt.Errorf("%s is %v (%s), not a procedure", name, obj, typeName(obj))
+	}
+	return c, nil
+}
+
+// Call calls the procedure defined as name with args. args are converted to
+// lisp objects: Go numbers to numbers, strings to strings, slices to lists,
+// maps to association lists and functions to procedures, other values are
+// passed as is. Use Decode to convert the result to a Go value.
+func (i *Interpreter) Call(name string, args ...any) (Object, error) {
+	c, err := i.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	objs := make([]Object, len(args))
+	for n, arg := range args {
+		obj, err := fromGo(reflect.ValueOf(arg))
+		if err != nil {
+			return nil, fmt.Errorf("%s: argument %d: %w", name, n, err)
+		}
+		objs[n] = obj
+	}
+
+	return c.Call(objs)
+}
+
+// Decode converts obj to a Go value and stores it in out, which must be a
+// non-nil pointer. Conversions are the same as for arguments of functions
+// passed to Register. Structs are decoded from association lists, keys are
+// matched to fields by a `humble:"name"` tag or by the field name, ignoring
+// case, '-' and '_' (e.g. max-items matches MaxItems).
+// Procedures decoded to a function type without a last error result panic with
+// a *CallbackError when they fail.
+//
+// e.g.
+//
+//	obj, err := interp.Call("rule", 10)
+//	...
+//	var out []string
+//	err = Decode(obj, &out)
+func Decode(obj Object, out any) error {
+	ptr := reflect.ValueOf(out)
+	if ptr.Kind() != reflect.Pointer || ptr.IsNil() {
+		return fmt.Errorf("decode: out must be a non-nil pointer, got %T", out)
+	}
+
+	v, err := toGo(obj, ptr.Type().Elem())
+	if err != nil {
+		return fmt.Errorf("decode: %w", err)
+	}
+	ptr.Elem().Set(v)
+	return nil
+}
+
+// goFunction returns a Function calling fn
+func goFunction(name string, fn any) (*Function, error) {
+	val := reflect.ValueOf(fn)
+	if val.Kind() != reflect.Func || val.IsNil() {
+		return nil, fmt.Errorf("%s: %v (%T) is not a function", name, fn, fn)
+	}
+
+	typ := val.Type()
+	minArgs, maxArgs := typ.NumIn(), typ.NumIn()
+	if typ.IsVariadic() {
+		minArgs, maxArgs = minArgs-1, -1
+	}
+
+	op := func(args []Object) (obj Object, err error) {
+		defer func() {
+			switch r := recover().(type) {
+			case nil:
+			case *CallbackError:
+				obj, err = nil, r.Err
+			default:
+				panic(r)
+			}
+		}()
+
+		in := make([]reflect.Value, len(args))
+		for n, arg := range args {
+			var argType reflect.Type
+			if typ.IsVariadic() && n >= typ.NumIn()-1 {
+				argType = typ.In(typ.NumIn() - 1).Elem()
+			} else {
+				argType = typ.In(n)
+			}
+
+			v, err := toGo(arg, argType)
+			if err != nil {
+				return nil, fmt.Errorf("argument %d: %w", n, err)
+			}
+			in[n] = v
+		}
+
+		return fromGoResults(val.Call(in))
+	}
+
+	return &Function{name, minArgs, maxArgs, op}, nil
+}
+
+// fromGoResults converts results of a Go function call to an object
+func fromGoResults(out []reflect.Value) (Object, error) {
+	if n := len(out); n > 0 && out[n-1].Type() == errorType {
+		if err, _ := out[n-1].Interface().(error); err != nil {
+			return nil, err
+		}
+		out = out[:n-1]
+	}
+
+	objs := make([]Object, len(out))
+	for i, v := range out {
+		obj, err := fromGo(v)
+		if err != nil {
+			return nil, err
+		}
+		objs[i] = obj
+	}
+
+	switch len(objs) {
+	case 0:
+		return Boolean(false), nil // unspecified
+	case 1:
+		return objs[0], nil
+	}
+	return NewList(objs...), nil
+}
+
+// toGo converts obj to a Go value of type typ
+func toGo(obj Object, typ reflect.Type) (reflect.Value, error) {
+	if obj != nil && reflect.TypeOf(obj).AssignableTo(typ) {
+		v := reflect.New(typ).Elem()
+		v.Set(reflect.ValueOf(obj))
+		return v, nil
+	}
+
+	if typ == bigIntType {
+		if n, ok := obj.(Number); ok && n.IsExact() {
+			return reflect.ValueOf(new(big.Int).Set(toBig(n))), nil
+		}
+		return reflect.Value{}, fmt.Errorf("can't convert %v (%s) to %s", obj, typeName(obj), typ)
+	}
+
+	v := reflect.New(typ).Elem()
+	switch typ.Kind() {
+	case reflect.Bool:
+		if b, ok := obj.(Boolean); ok {
+			v.SetBool(bool(b))
+			return v, nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := obj.(Number); ok {
+			i, ok := int64Value(n)
+			if !ok || v.OverflowInt(i) {
+				return v, fmt.Errorf("%v is out of range for %s", n, typ)
+			}
+			v.SetInt(i)
+			return v, nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n, ok := obj.(Number); ok {
+			u, ok := uint64Value(n)
+			if !ok || v.OverflowUint(u) {
+				return v, fmt.Errorf("%v is out of range for %s", n, typ)
+			}
+			v.SetUint(u)
+			return v, nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if n, ok := obj.(Number); ok && isReal(n) {
+			f := toFloat(n)
+			if v.OverflowFloat(f) || (n.IsExact() && math.IsInf(f, 0)) {
+				return v, fmt.Errorf("%v is out of range for %s", n, typ)
+			}
+			v.SetFloat(f)
+			return v, nil
+		}
+	case reflect.Complex64, reflect.Complex128:
+		if n, ok := obj.(Number); ok {
+			v.SetComplex(toComplex(n))
+			return v, nil
+		}
+	case reflect.String:
+		switch s := obj.(type) {
+		case String:
+			v.SetString(string(s))
+			return v, nil
+		case Symbol:
+			v.SetString(string(s))
+			return v, nil
+		case Keyword:
+			v.SetString(string(s))
+			return v, nil
+		}
+	case reflect.Slice:
+		if bv, ok := obj.(*Bytevector); ok && typ.Elem().Kind() == reflect.Uint8 {
+			v = reflect.MakeSlice(typ, len(bv.Bytes), len(bv.Bytes))
+			for i, b := range bv.Bytes {
+				v.Index(i).SetUint(uint64(b))
+			}
+			return v, nil
+		}
+
+		items, err := listToSlice(obj)
+		if vec, ok := obj.(*Vector); ok {
+			items, err = vec.Items, nil
+		}
+		if err != nil {
+			break
+		}
+
+		v = reflect.MakeSlice(typ, len(items), len(items))
+		for i, item := range items {
+			iv, err := toGo(item, typ.Elem())
+			if err != nil {
+				return v, fmt.Errorf("item %d: %w", i, err)
+			}
+			v.Index(i).Set(iv)
+		}
+		return v, nil
+	case reflect.Map:
+		items, err := listToSlice(obj)
+		if err != nil {
+			break
+		}
+
+		v = reflect.MakeMapWithSize(typ, len(items))
+		for i, item := range items {
+			p, ok := item.(*Pair)
+			if !ok {
+				return v, fmt.Errorf("item %d: %v is not a pair", i, item)
+			}
+
+			key, err := toGo(p.Car, typ.Key())
+			if err != nil {
+				return v, fmt.Errorf("key %d: %w", i, err)
+			}
+
+			val, err := toGo(p.Cdr, typ.Elem())
+			if err != nil {
+				return v, fmt.Errorf("value %d: %w", i, err)
+			}
+			v.SetMapIndex(key, val)
+		}
+		return v, nil
+	case reflect.Struct:
+		items, err := listToSlice(obj)
+		if err != nil {
+			break
+		}
+
+		for i, item := range items {
+			p, ok := item.(*Pair)
+			if !ok {
+				return v, fmt.Errorf("item %d: %v is not a pair", i, item)
+			}
+
+			var key string
+			switch k := p.Car.(type) {
+			case Symbol:
+				key = string(k)
+			case Keyword:
+				key = string(k)
+			case String:
+				key = string(k)
+			default:
+				return v, fmt.Errorf("item %d: key %v is not a symbol or a string", i, p.Car)
+			}
+
+			field, ok := structField(typ, key)
+			if !ok {
+				continue
+			}
+
+			val, err := toGo(p.Cdr, field.Type)
+			if err != nil {
+				return v, fmt.Errorf("field %s: %w", field.Name, err)
+			}
+			v.FieldByIndex(field.Index).Set(val)
+		}
+		return v, nil
+	case reflect.Pointer:
+		if _, ok := obj.(Null); ok {
+			return v, nil // nil pointer
+		}
+
+		elem, err := toGo(obj, typ.Elem())
+		if err != nil {
+			return v, err
+		}
+
+		v = reflect.New(typ.Elem())
+		v.Elem().Set(elem)
+		return v, nil
+	case reflect.Func:
+		if c, ok := obj.(Callable); ok {
+			return goCallback(c, typ), nil
+		}
+	}
+
+	return v, fmt.Errorf("can't convert %v (%s) to %s", obj, typeName(obj), typ)
+}
+
+// structField returns the exported field of struct type typ matching key
+func structField(typ reflect.Type, key string) (reflect.StructField, bool) {
+	for _, field := range reflect.VisibleFields(typ) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+
+		if tag, ok := field.Tag.Lookup("humble"); ok {
+			if tag == key {
+				return field, true
+			}
+			continue
+		}
+
+		if normalizeName(field.Name) == normalizeName(key) {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// normalizeName normalizes name for matching. e.g. max-items → maxitems
+func normalizeName(name string) string {
+	name = strings.ToLower(name)
+	return strings.NewReplacer("-", "", "_", "").Replace(name)
+}
+
+// int64Value returns n as int64 if it's an integer in the int64 range
+func int64Value(n Number) (int64, bool) {
+	switch n := n.(type) {
+	case Integer:
+		return int64(n), true
+	case Real:
+		f := float64(n)
+		if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+			return int64(f), true
+		}
+	}
+	return 0, false
+}
+
+// uint64Value returns n as uint64 if it's an integer in the uint64 range
+func uint64Value(n Number) (uint64, bool) {
+	switch n := n.(type) {
+	case Integer:
+		return uint64(n), n >= 0
+	case BigInt:
+		return n.Uint64(), n.IsUint64()
+	case Real:
+		f := float64(n)
+		if f == math.Trunc(f) && f >= 0 && f < math.MaxUint64 {
+			return uint64(f), true
+		}
+	}
+	return 0, false
+}
+
+// typeName returns the name of obj type, used in error messages
+func typeName(obj Object) string {
+	switch obj.(type) {
+	case Number:
+		return "number"
+	case String:
+		return "string"
+	case Symbol:
+		return "symbol"
+	case Boolean:
+		return "boolean"
+	case Keyword:
+		return "keyword"
+	case *Pair:
+		return "pair"
+	case *Vector:
+		return "vector"
+	case *Bytevector:
+		return "bytevector"
+	case Null:
+		return "empty list"
+	case Callable:
+		return "procedure"
+	}
+	return fmt.Sprintf("%T", obj)
+}
+
+// CallbackError is the panic value of a Go function calling a procedure, when
+// the call fails and the function has no error result. Functions registered
+// with Register recover it and return Err as their error.
+type CallbackError struct {
+	Err error
+}
+
+func (e *CallbackError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error of the procedure call
+func (e *CallbackError) Unwrap() error {
+	return e.Err
+}
+
+// goCallback returns a Go function of type typ that calls c. If the lisp call
+// fails and typ has no error result, the Go function panics with a
+// *CallbackError.
+func goCallback(c Callable, typ reflect.Type) reflect.Value {
+	fn := func(in []reflect.Value) []reflect.Value {
+		out := make([]reflect.Value, typ.NumOut())
+		for i := range out {
+			out[i] = reflect.Zero(typ.Out(i))
+		}
+
+		fail := func(err error) []reflect.Value {
+			if len(out) == 0 || typ.Out(len(out)-1) != errorType {
+				panic(&CallbackError{err})
+			}
+			out[len(out)-1] = reflect.ValueOf(&err).Elem()
+			return out
+		}
+
+		args := make([]Object, len(in))
+		for i, v := range in {
+			obj, err := fromGo(v)
+			if err != nil {
+				return fail(err)
+			}
+			args[i] = obj
+		}
+
+		obj, err := c.Call(args)
+		if err != nil {
+			return fail(err)
+		}
+
+		nvals := len(out)
+		if nvals > 0 && typ.Out(nvals-1) == errorType {
+			nvals--
+		}
+
+		switch nvals {
+		case 0:
+			// ignore result
+		case 1:
+			v, err := toGo(obj, typ.Out(0))
+			if err != nil {
+				return fail(err)
+			}
+			out[0] = v
+		default:
+			items, err := listToSlice(obj)
+			if err != nil || len(items) != nvals {
+				return fail(fmt.Errorf("%v is not a list of %d values", obj, nvals))
+			}
+
+			for i, item := range items {
+				v, err := toGo(item, typ.Out(i))
+				if err != nil {
+					return fail(err)
+				}
+				out[i] = v
+			}
+		}
+
+		return out
+	}
+
+	return reflect.MakeFunc(typ, fn)
+}
+
+// fromGo converts a Go value to an object
+func fromGo(v reflect.Value) (Object, error) {
+	if !v.IsValid() {
+		return Null{}, nil
+	}
+
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return Null{}, nil
+		}
+		v = v.Elem()
+	}
+
+	switch obj := v.Interface().(type) {
+	case Number, String, Symbol, Keyword, Boolean, *Pair, *Vector, *Bytevector, Null, Callable:
+		return obj, nil
+	case *big.Int:
+		if obj == nil {
+			return Null{}, nil
+		}
+		return normBig(new(big.Int).Set(obj)), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return Boolean(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Integer(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return normBig(new(big.Int).SetUint64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return Real(v.Float()), nil
+	case reflect.Complex64, reflect.Complex128:
+		return normComplex(v.Complex()), nil
+	case reflect.String:
+		return String(v.String()), nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return Null{}, nil
+		}
+
+		items := make([]Object, v.Len())
+		for i := range items {
+			obj, err := fromGo(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			items[i] = obj
+		}
+		return NewList(items...), nil
+	case reflect.Map:
+		// Sort keys so the association list is in a stable order
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+		})
+
+		items := make([]Object, len(keys))
+		for i, key := range keys {
+			k, err := fromGo(key)
+			if err != nil {
+				return nil, err
+			}
+
+			val, err := fromGo(v.MapIndex(key))
+			if err != nil {
+				return nil, err
+			}
+			items[i] = &Pair{k, val}
+		}
+		return NewList(items...), nil
+	case reflect.Func:
+		if v.IsNil() {
+			return Null{}, nil
+		}
+		return goFunction("go-function", v.Interface())
+	}
+
+	// Other Go values (pointers, structs ...) are passed to lisp as is
+	return v.Interface(), nil
+}
@@ -0,0 +1,245 @@
+package humble
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type account struct {
+	balance float64
+}
+
+func TestRegister(t *testing.T) {
+	interp := New()
+	funcs := map[string]any{
+		"repeat": strings.Repeat,
+		"parse-float": func(s string, bits int) (float64, error) {
+			return strconv.ParseFloat(s, bits)
+		},
+		"join": func(sep string, parts ...string) string {
+			return strings.Join(parts, sep)
+		},
+		"sum": func(vals []int) int {
+			total := 0
+			for _, v := range vals {
+				total += v
+			}
+			return total
+		},
+		"checksum": func(data []byte) int {
+			total := 0
+			for _, b := range data {
+				total += int(b)
+			}
+			return total
+		},
+		"counts": func(s string) map[string]int {
+			m := make(map[string]int)
+			for _, f := range strings.Fields(s) {
+				m[f]++
+			}
+			return m
+		},
+		"apply-twice": func(f func(int) int, n int) int {
+			return f(f(n))
+		},
+		"div-mod": func(a, b int) (int, int) {
+			return a / b, a % b
+		},
+		"new-account": func(balance float64) *account {
+			return &account{balance}
+		},
+		"balance": func(a *account) float64 {
+			return a.balance
+		},
+		"f32": func(f float32) float32 {
+			return f
+		},
+	}
+	for name, fn := range funcs {
+		if err := interp.Register(name, fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		expr string
+		out  string
+	}{
+		{`(repeat "ab" 3)`, `"ababab"`},
+		{`(parse-float "2.5" 64)`, "2.5"},
+		{`(join ", ")`, `""`},
+		{`(join ", " "a" "b" 'c)`, `"a, b, c"`},
+		{`(sum '(1 2 3))`, "6"},
+		{`(sum #(1 2 3))`, "6"},
+		{`(checksum #u8(1 2 255))`, "258"},
+		{`(counts "a b a")`, `(("a" . 2) ("b" . 1))`},
+		{`(apply-twice (lambda (n) (* n 3)) 2)`, "18"},
+		{`(guard (e (#t e)) (apply-twice (lambda (n) (raise 'oops)) 2))`, "oops"},
+		{`(div-mod 7 2)`, "(3 1)"},
+		{`(balance (new-account 10.5))`, "10.5"},
+		{`(f32 1.5)`, "1.5"},
+		{`(f32 +inf.0)`, "+inf.0"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			out := fmt.Sprint(run(t, interp, tc.expr))
+			if tc.out != out {
+				t.Fatalf("result mismatch: %s != %s", tc.out, out)
+			}
+		})
+	}
+
+	errTestCases := []struct {
+		expr string
+		err  string
+	}{
+		{`(parse-float "x" 64)`, `parse-float - strconv.ParseFloat: parsing "x": invalid syntax`},
+		{`(repeat "a" 1.5)`, "repeat - argument 1: 1.5 is out of range for int"},
+		{`(f32 1e300)`, "f32 - argument 0: 1e+300 is out of range for float32"},
+		{`(new-account (expt 10 400))`, "new-account - argument 0: 1" + strings.Repeat("0", 400) + " is out of range for float64"},
+		{`(sum '(1 "2"))`, `sum - argument 0: item 1: can't convert "2" (string) to int`},
+		{`(repeat "a")`, "repeat - wrong number of arguments (want 2, got 1)"},
+		{`(join)`, "join - wrong number of arguments (want at least 1, got 0)"},
+		{`(apply-twice (lambda (n) (car n)) 2)`, "car - argument 0: got 2 of type humble.Integer"},
+		{`(apply-twice (lambda (n) (raise 'oops)) 2)`, "oops"},
+	}
+
+	for _, tc := range errTestCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			_, err := interp.Eval(tc.expr)
+			if err == nil {
+				t.Fatal("no error")
+			}
+
+			if !strings.HasSuffix(err.Error(), tc.err) {
+				t.Fatalf("error mismatch: %q doesn't end with %q", err.Error(), tc.err)
+			}
+		})
+	}
+}
+
+func TestRegisterBad(t *testing.T) {
+	if err := New().Register("x", 1); err == nil {
+		t.Fatal("no error")
+	}
+}
+
+type rule struct {
+	Name     string
+	MaxItems int
+	Tags     []string `humble:"labels"`
+	Limits   map[string]float64
+	Next     *rule
+}
+
+func TestCall(t *testing.T) {
+	interp := New()
+	code := `
+(define make-rule
+  (lambda (name n)
+    (list (cons 'name name)
+	  (cons 'max-items (* n 2))
+	  (cons 'labels (string-split name "-"))
+	  (cons "limits" (list (cons "low" 0.5)))
+	  (cons 'next (list (cons 'name "next"))))))
+
+(define add (lambda (a b) (+ a b)))
+(define not-proc 7)
+`
+	run(t, interp, code)
+
+	obj, err := interp.Call("make-rule", "big-order", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var r rule
+	if err := Decode(obj, &r); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := rule{
+		Name:     "big-order",
+		MaxItems: 10,
+		Tags:     []string{"big", "order"},
+		Limits:   map[string]float64{"low": 0.5},
+		Next:     &rule{Name: "next"},
+	}
+	if fmt.Sprint(r.Next) != fmt.Sprint(expected.Next) {
+		t.Fatalf("result mismatch: %+v != %+v", r.Next, expected.Next)
+	}
+	r.Next, expected.Next = nil, nil
+	if fmt.Sprint(r) != fmt.Sprint(expected) {
+		t.Fatalf("result mismatch: %+v != %+v", r, expected)
+	}
+
+	obj, err = interp.Call("add", 1, 2.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var f float64
+	if err := Decode(obj, &f); err != nil {
+		t.Fatal(err)
+	}
+	if f != 3.5 {
+		t.Fatalf("result mismatch: %v != %v", f, 3.5)
+	}
+
+	var n int
+	err = Decode(obj, &n)
+	if err == nil || err.Error() != "decode: 3.5 is out of range for int" {
+		t.Fatalf("bad error: %v", err)
+	}
+
+	var s string
+	err = Decode(obj, &s)
+	if err == nil || err.Error() != "decode: can't convert 3.5 (number) to string" {
+		t.Fatalf("bad error: %v", err)
+	}
+
+	if _, err := interp.Call("not-proc"); err == nil {
+		t.Fatal("called a number")
+	}
+
+	if _, err := interp.Call("no-such-proc"); err == nil {
+		t.Fatal("called unknown name")
+	}
+
+	if err := Decode(obj, n); err == nil {
+		t.Fatal("decoded to non pointer")
+	}
+}
+
+func TestDecodeFuncPanic(t *testing.T) {
+	interp := New()
+	run(t, interp, "(define (bad n) (car n))")
+	c, err := interp.Lookup("bad")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var bad func(int) int
+	if err := Decode(c, &bad); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		r := recover()
+		cerr, ok := r.(*CallbackError)
+		if !ok {
+			t.Fatalf("bad panic value: %#v", r)
+		}
+
+		const msg = "<test>:1:17: car - argument 0: got 1 of type humble.Integer"
+		if cerr.Error() != msg {
+			t.Fatalf("error mismatch: %q != %q", cerr.Error(), msg)
+		}
+	}()
+	bad(1)
+	t.Fatal("no panic")
+}
@@ -1,167 +1,521 @@
-package main
+// Package humble is a small lisp interpreter.
+package humble
 
 import (
-	"bufio"
 	"bytes"
-	"flag"
+	"errors"
 	"fmt"
-	"io"
-	"os"
-	"path"
-	"regexp"
+	"math"
 	"strconv"
 	"strings"
 )
 
 var (
-	builtins *Environment
+	// builtins are copied to the global environment of every Interpreter
+	builtins = NewEnvironment(nil)
 )
 
 func init() {
 	m := map[Symbol]Object{
-		"+": &Function{"+", 0, func(args []Number) (Object, error) {
-			total := Number(0.0)
+		"+": &Function{"+", 0, -1, numeric(func(args []Number) (Object, error) {
+			var total Number = Integer(0)
 			for _, val := range args {
-				total += val
+				total = add(total, val)
 			}
 
 			return total, nil
-		}},
-		"*": &Function{"*", 0, func(args []Number) (Object, error) {
-			total := Number(1.0)
+		})},
+		"*": &Function{"*", 0, -1, numeric(func(args []Number) (Object, error) {
+			var total Number = Integer(1)
 			for _, val := range args {
-				total *= val
+				total = mul(total, val)
 			}
 
 			return total, nil
+		})},
+		"%": &Function{"%", 2, 2, numeric(func(args []Number) (Object, error) {
+			return remainder(args[0], args[1])
+		})},
+		"eq?": &Function{"eq?", 2, 2, func(args []Object) (Object, error) {
+			return Boolean(args[0] == args[1]), nil
 		}},
-		"begin": &begin{},
-		"%": &Function{"%", 2, func(args []Number) (Object, error) {
-			if args[1] == 0 {
-				return nil, fmt.Errorf("division by zero")
-			}
-			return Number(int(args[0]) % int(args[1])), nil
+		"not": &Function{"not", 1, 1, func(args []Object) (Object, error) {
+			return Boolean(!isTrue(args[0])), nil
 		}},
-		"eq?": &Function{"eq?", 2, func(args []Number) (Object, error) {
-			if args[0] == args[1] {
-				return 1.0, nil
-			}
-			return 0.0, nil
+		"boolean?": &Function{"boolean?", 1, 1, func(args []Object) (Object, error) {
+			_, ok := args[0].(Boolean)
+			return Boolean(ok), nil
 		}},
-		// MT: In scheme these get arbitrary number of arguments
-		"<": &Function{"<", 2, func(args []Number) (Object, error) {
-			if args[0] < args[1] {
-				return 1.0, nil
-			}
-			return 0.0, nil
+		"number?": &Function{"number?", 1, 1, func(args []Object) (Object, error) {
+			_, ok := args[0].(Number)
+			return Boolean(ok), nil
 		}},
-		"-": &Function{"-", 2, func(args []Number) (Object, error) {
-			return args[0] - args[1], nil
+		"string?": &Function{"string?", 1, 1, func(args []Object) (Object, error) {
+			_, ok := args[0].(String)
+			return Boolean(ok), nil
 		}},
-		"/": &Function{"/", 2, func(args []Number) (Object, error) {
-			if args[1] == 0 {
-				return nil, fmt.Errorf("division by zero")
-			}
-			return args[0] / args[1], nil
+		"procedure?": &Function{"procedure?", 1, 1, func(args []Object) (Object, error) {
+			_, ok := args[0].(Callable)
+			return Boolean(ok), nil
+		}},
+		"keyword?": &Function{"keyword?", 1, 1, func(args []Object) (Object, error) {
+			_, ok := args[0].(Keyword)
+			return Boolean(ok), nil
 		}},
-		"print": &Function{"print", 0, func(args []Number) (Object, error) {
+		// (- 5) → -5, (- 10 1 2) → 7
+		"-": &Function{"-", 1, -1, numeric(func(args []Number) (Object, error) {
+			if len(args) == 1 {
+				return sub(Integer(0), args[0]), nil
+			}
+
+			total := args[0]
+			for _, val := range args[1:] {
+				total = sub(total, val)
+			}
+			return total, nil
+		})},
+		// (/ 2) → 1/2, (/ 12 2 3) → 2
+		"/": &Function{"/", 1, -1, numeric(func(args []Number) (Object, error) {
+			if len(args) == 1 {
+				return div(Integer(1), args[0])
+			}
+
+			total := args[0]
+			for _, val := range args[1:] {
+				var err error
+				if total, err = div(total, val); err != nil {
+					return nil, err
+				}
+			}
+			return total, nil
+		})},
+		"print": &Function{"print", 0, -1, func(args []Object) (Object, error) {
 			var buf bytes.Buffer
 			for i, v := range args {
-				fmt.Fprintf(&buf, "%.2f", v)
+				switch v := v.(type) {
+				case Real:
+					if f := float64(v); math.IsInf(f, 0) || math.IsNaN(f) {
+						buf.WriteString(v.String())
+					} else {
+						fmt.Fprintf(&buf, "%.2f", v)
+					}
+				case String:
+					buf.WriteString(string(v))
+				default:
+					fmt.Fprint(&buf, v)
+				}
 				if i < len(args)-1 {
 					fmt.Fprintf(&buf, " ")
 				}
 			}
 			fmt.Println(buf.String())
-			return float64(len(buf.Bytes())), nil
+			return Integer(len(buf.Bytes())), nil
 		}},
 	}
 
-	builtins = &Environment{m, nil}
+	for name, obj := range m {
+		builtins.Set(name, obj)
+	}
+}
+
+// Position in source code
+type Position struct {
+	File string
+	Line int
+	Col  int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Col)
+}
+
+// maxFrames is the maximal number of frames kept in an error stack
+const maxFrames = 1000
+
+// Error is an error at a position in the source code
+type Error struct {
+	Pos    Position
+	Err    error
+	Stack  []Frame // procedure calls active when the error happened, most recent first
+	elided int     // number of frames dropped before the outermost frame
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Err)
+}
+
+// Traceback returns the error with the call stack, repeated frames are shown
+// once. e.g.
+//
+//	Traceback (most recent call last):
+//	  rules.scm:12:1 in <top>
+//	  rules.scm:4:5 in check
+//	rules.scm:2:10: car - argument 0: got 1 of type humble.Integer
+func (e *Error) Traceback() string {
+	var buf strings.Builder
+	if len(e.Stack) > 0 {
+		buf.WriteString("Traceback (most recent call last):\n")
+		last := len(e.Stack) - 1
+		for i := last; i >= 0; {
+			f := e.Stack[i]
+			n := 1
+			for i-n >= 0 && e.Stack[i-n] == f && !(i == last && e.elided > 0) {
+				n++
+			}
+			fmt.Fprintf(&buf, "  %s\n", f)
+			if n > 1 {
+				fmt.Fprintf(&buf, "  [previous frame repeated %d more times]\n", n-1)
+			}
+			if i == last && e.elided > 0 {
+				fmt.Fprintf(&buf, "  [%d more frames]\n", e.elided)
+			}
+			i -= n
+		}
+	}
+	buf.WriteString(e.Error())
+	return buf.String()
+}
+
+// Frame is a procedure call in the stack, Pos is the current position in the
+// procedure.
+type Frame struct {
+	Name string // empty for top level code
+	Pos  Position
 }
 
-// Token in the language
-type Token string
+func (f Frame) String() string {
+	name := f.Name
+	if name == "" {
+		name = "<top>"
+	}
+	return fmt.Sprintf("%s in %s", f.Pos, name)
+}
+
+// addFrame adds a call to procedure name at callSite to the stack of err.
+// Called when err leaves the procedure. Once the stack has maxFrames frames,
+// the outermost frame replaces the one before it, dropped frames are counted
+// in elided.
+func addFrame(err error, name string, callSite Position) {
+	var perr *Error
+	if !errors.As(err, &perr) {
+		return
+	}
+
+	n := len(perr.Stack)
+	if n == 0 {
+		perr.Stack = append(perr.Stack, Frame{name, perr.Pos})
+		n++
+	} else {
+		perr.Stack[n-1].Name = name
+	}
 
-var commentRe = regexp.MustCompile(`;.*?\n`)
+	// Name of the caller is set when err leaves it
+	if n == maxFrames {
+		perr.Stack[n-1] = Frame{Pos: callSite}
+		perr.elided++
+		return
+	}
+	perr.Stack = append(perr.Stack, Frame{Pos: callSite})
+}
 
-// Tokenize splits the t list of tokens
-func Tokenize(code string) []Token {
-	code = commentRe.ReplaceAllString(code, "")
-	code = strings.ReplaceAll(code, "(", " ( ")
-	code = strings.ReplaceAll(code, ")", " ) ")
+// setCallSite sets the call site of the outermost frame in the stack of err,
+// if it's unknown (procedures called from builtins don't know it).
+func setCallSite(err error, pos Position) {
+	var perr *Error
+	if !errors.As(err, &perr) {
+		return
+	}
 
-	var tokens []Token
-	for _, tok := range strings.Fields(code) {
-		tokens = append(tokens, Token(tok))
+	if n := len(perr.Stack); n > 0 && perr.Stack[n-1].Pos == (Position{}) {
+		perr.Stack[n-1].Pos = pos
 	}
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
 
-	return tokens
+// errorAt returns an error at pos
+func errorAt(pos Position, format string, args ...any) error {
+	return &Error{Pos: pos, Err: fmt.Errorf(format, args...)}
+}
+
+// withPos adds pos to err, unless err already has a position
+func withPos(err error, pos Position) error {
+	var perr *Error
+	if errors.As(err, &perr) {
+		return err
+	}
+	return &Error{Pos: pos, Err: err}
 }
 
 // Expression to be computed
 type Expression interface {
 	Eval(env *Environment) (Object, error)
+	Pos() Position
 }
 
 // Object in the language
 type Object any
 
 // NumberExpr is a number. e.g. 3.14
-type NumberExpr float64
+type NumberExpr struct {
+	Value Number
+	pos   Position
+}
 
 func (e NumberExpr) String() string {
-	return fmt.Sprintf("%f", e)
+	return e.Value.String()
+}
+
+// Pos returns the expression position
+func (e NumberExpr) Pos() Position {
+	return e.pos
+}
+
+// Boolean is a boolean in the language
+type Boolean bool
+
+func (b Boolean) String() string {
+	if b {
+		return "#t"
+	}
+	return "#f"
+}
+
+// isTrue returns the truth value of obj, only #f is false
+func isTrue(obj Object) bool {
+	return obj != Boolean(false)
+}
+
+// BooleanExpr is a boolean literal. e.g. #t
+type BooleanExpr struct {
+	Value Boolean
+	pos   Position
+}
+
+func (e BooleanExpr) String() string {
+	return e.Value.String()
+}
+
+// Pos returns the expression position
+func (e BooleanExpr) Pos() Position {
+	return e.pos
+}
+
+// Eval evaluates value
+func (e BooleanExpr) Eval(env *Environment) (Object, error) {
+	return e.Value, nil
+}
+
+// StringExpr is a string literal. e.g. "hello"
+type StringExpr struct {
+	Value String
+	pos   Position
 }
 
-// Number is a number in the language
-type Number float64
+func (e StringExpr) String() string {
+	return e.Value.String()
+}
+
+// Pos returns the expression position
+func (e StringExpr) Pos() Position {
+	return e.pos
+}
+
+// Eval evaluates value
+func (e StringExpr) Eval(env *Environment) (Object, error) {
+	return e.Value, nil
+}
 
 // Eval evaluates value
 func (e NumberExpr) Eval(env *Environment) (Object, error) {
-	return Number(e), nil
+	return e.Value, nil
+}
+
+// Keyword is a keyword, used to name arguments. e.g. #:width
+type Keyword string
+
+func (k Keyword) String() string {
+	return "#:" + string(k)
+}
+
+// KeywordExpr is a keyword literal, it evaluates to itself. e.g. #:width
+type KeywordExpr struct {
+	Value Keyword
+	pos   Position
+}
+
+func (e KeywordExpr) String() string {
+	return e.Value.String()
+}
+
+// Pos returns the expression position
+func (e KeywordExpr) Pos() Position {
+	return e.pos
+}
+
+// Eval evaluates value
+func (e KeywordExpr) Eval(env *Environment) (Object, error) {
+	return e.Value, nil
 }
 
-// Symbol is a symbol. e.g. pi
+// Symbol is a name
 type Symbol string
 
+// SymbolExpr is a symbol. e.g. pi
+type SymbolExpr struct {
+	Name  Symbol
+	pos   Position
+	alias *alias // set for symbols introduced by macro expansion
+}
+
+func (e SymbolExpr) String() string {
+	return string(e.Name)
+}
+
+// Pos returns the expression position
+func (e SymbolExpr) Pos() Position {
+	return e.pos
+}
+
 // Eval evaluates value
-func (e Symbol) Eval(env *Environment) (Object, error) {
-	env = env.Find(e)
+func (e SymbolExpr) Eval(env *Environment) (Object, error) {
+	sym, env := e.resolve(env)
+	env = env.Find(sym.Name)
 	if env == nil {
-		return nil, fmt.Errorf("unknown name - %q", e)
+		return nil, &Error{Pos: e.pos, Err: &ErrorObject{"unknown name", []Object{sym.Name}}}
 	}
 
-	return env.Get(e), nil
+	val := env.Get(sym.Name)
+	if _, ok := val.(unassigned); ok {
+		return nil, errorAt(e.pos, "%q used before initialization", sym.Name)
+	}
+	return val, nil
 }
 
 // ListExpr is a list expression. e.g. (* 4 5)
-type ListExpr []Expression
+type ListExpr struct {
+	Items []Expression
+	Tail  Expression // last cdr of dotted list. e.g. c in (a b . c)
+	pos   Position
+}
 
 func (e ListExpr) String() string {
 	var buf bytes.Buffer
 	fmt.Fprintf(&buf, "(")
-	for i, c := range e {
+	for i, c := range e.Items {
 		fmt.Fprintf(&buf, "%s", c)
-		if i < len(e)-1 {
+		if i < len(e.Items)-1 {
 			fmt.Fprintf(&buf, " ")
 		}
 	}
+	if e.Tail != nil {
+		fmt.Fprintf(&buf, " . %s", e.Tail)
+	}
 	fmt.Fprintf(&buf, ")")
 	return buf.String()
 }
 
-// Eval evaluates value
+// Pos returns the expression position
+func (e ListExpr) Pos() Position {
+	return e.pos
+}
+
+// Eval evaluates value.
+// Calls in tail position are returned from eval as a *tailCall and are
+// evaluated here in a loop (trampoline), so tail recursion won't grow the stack.
 func (e ListExpr) Eval(env *Environment) (Object, error) {
-	if len(e) == 0 {
+	var frame *Frame // procedure running in the loop, with its call site
+	callSite := e.pos
+	obj, err := e.eval(env)
+	for err == nil {
+		tc, ok := obj.(*tailCall)
+		if !ok {
+			return obj, nil
+		}
+
+		if tc.proc != nil { // procedure call, tail calls replace the frame
+			// The first call can be in tail position of the evaluated
+			// expression, e.g. (f x) in (if c (f x))
+			if frame == nil {
+				callSite = e.pos
+			}
+			frame = &Frame{tc.proc.displayName(), callSite}
+			obj, err = evalScopeBody(tc.proc.body, tc.env)
+			continue
+		}
+
+		le, ok := tc.expr.(ListExpr)
+		if !ok {
+			obj, err = tc.expr.Eval(tc.env)
+			continue
+		}
+		e, env = le, tc.env
+		obj, err = e.eval(env)
+	}
+
+	err = withPos(err, e.pos)
+	setCallSite(err, e.pos)
+	if frame != nil {
+		addFrame(err, frame.Name, frame.Pos)
+	}
+	return nil, err
+}
+
+// tailCall is an expression in tail position, left for ListExpr.Eval to
+// evaluate. If proc is set, it's a call to proc with env holding the arguments.
+type tailCall struct {
+	expr Expression
+	env  *Environment
+	proc *Lambda
+}
+
+// force evaluates obj if it's a *tailCall
+func force(obj Object, err error) (Object, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	tc, ok := obj.(*tailCall)
+	if !ok {
+		return obj, nil
+	}
+
+	if tc.proc != nil {
+		return force(evalScopeBody(tc.proc.body, tc.env))
+	}
+	return tc.expr.Eval(tc.env)
+}
+
+// eval evaluates e, it might return a *tailCall
+func (e ListExpr) eval(env *Environment) (Object, error) {
+	if len(e.Items) == 0 {
 		return nil, fmt.Errorf("empty list expression")
 	}
 
-	rest := e[1:]
-	// Try special forms first
-	op, ok := e[0].(Symbol)
-	if ok {
-		switch op {
+	if e.Tail != nil {
+		return nil, fmt.Errorf("dotted list in expression")
+	}
+
+	rest := e.Items[1:]
+	// Try macros & special forms first
+	if op, ok := e.Items[0].(SymbolExpr); ok {
+		sym, symEnv := op.resolve(env)
+		if m, ok := lookupMacro(sym.Name, symEnv); ok {
+			expr, err := m.expand(e)
+			if err != nil {
+				return nil, err
+			}
+			return &tailCall{expr: expr, env: env}, nil
+		}
+
+		switch sym.Name {
+		case "quote": // (quote (1 2)), '(1 2)
+			return evalQuote(rest, env)
+		case "quasiquote": // (quasiquote (1 (unquote x))), `(1 ,x)
+			return evalQuasiquote(rest, env)
 		case "define": // (define n 27)
 			return evalDefine(rest, env)
 		case "set!": // (set! n 27)
@@ -172,12 +526,40 @@ func (e ListExpr) Eval(env *Environment) (Object, error) {
 			return evalOr(rest, env)
 		case "and": // (and), (and 0 1)
 			return evalAnd(rest, env)
+		case "guard": // (guard (e ((string? e) e)) (raise "oops"))
+			return evalGuard(rest, env)
+		case "begin": // (begin (define x 1) (+ x 1))
+			return evalBegin(rest, env)
 		case "lambda": // (lambda (n) (+ n 1))
 			return evalLambda(rest, env)
+		case "let": // (let ((x 1) (y 2)) (+ x y)), (let loop ((i 0)) (loop (+ i 1)))
+			return evalLet(rest, env)
+		case "let*": // (let* ((x 1) (y (+ x 1))) (* x y))
+			return evalLetStar(rest, env)
+		case "letrec", "letrec*": // (letrec ((even? (lambda (n) ...)) (odd? ...)) (even? 10))
+			return evalLetrec(rest, env, sym.Name)
+		case "cond": // (cond ((< x 0) -1) ((> x 0) 1) (else 0))
+			return evalCond(rest, env)
+		case "case": // (case x ((1 2) 'small) (else 'big))
+			return evalCase(rest, env)
+		case "when": // (when (> x 0) (print x) x)
+			return evalWhen(rest, env, true)
+		case "unless": // (unless (> x 0) (print x) x)
+			return evalWhen(rest, env, false)
+		case "do": // (do ((i 0 (+ i 1))) ((= i 3) i) (print i))
+			return evalDo(rest, env)
+		case "define-syntax": // (define-syntax inc (syntax-rules () ((_ n) (+ n 1))))
+			return evalDefineSyntax(rest, env)
+		case "let-syntax": // (let-syntax ((inc (syntax-rules ...))) (inc 1))
+			return evalLetSyntax(rest, env, false)
+		case "letrec-syntax":
+			return evalLetSyntax(rest, env, true)
+		case "defmacro": // (defmacro unless (c e) (list 'if c #f e))
+			return evalDefmacro(rest, env)
 		}
 	}
 
-	obj, err := e[0].Eval(env)
+	obj, err := e.Items[0].Eval(env)
 	if err != nil {
 		return nil, err
 	}
@@ -196,15 +578,266 @@ func (e ListExpr) Eval(env *Environment) (Object, error) {
 		params = append(params, obj)
 	}
 
-	return c.Call(params)
+	return applyTail(c, params)
+}
+
+// applyTail calls c with args, lambda calls are returned as *tailCall
+func applyTail(c Callable, args []Object) (Object, error) {
+	if l, ok := c.(*Lambda); ok {
+		env, err := l.bind(args)
+		if err != nil {
+			return nil, err
+		}
+		return &tailCall{env: env, proc: l}, nil
+	}
+
+	return c.Call(args)
+}
+
+func evalQuote(args []Expression, env *Environment) (Object, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("wrong number of arguments for 'quote'")
+	}
+
+	return toDatum(args[0]), nil
+}
+
+// toDatum converts expression to data. e.g. (a "b") → list of symbol & string
+func toDatum(e Expression) Object {
+	switch e := e.(type) {
+	case NumberExpr:
+		return e.Value
+	case StringExpr:
+		return e.Value
+	case BooleanExpr:
+		return e.Value
+	case KeywordExpr:
+		return e.Value
+	case VectorExpr:
+		items := make([]Object, len(e.Items))
+		for i, item := range e.Items {
+			items[i] = toDatum(item)
+		}
+		return &Vector{items}
+	case BytevectorExpr:
+		return &Bytevector{bytes.Clone(e.Value)}
+	case SymbolExpr:
+		for e.alias != nil {
+			e = e.alias.sym
+		}
+		return e.Name
+	case ListExpr:
+		var tail Object = Null{}
+		if e.Tail != nil {
+			tail = toDatum(e.Tail)
+		}
+
+		for i := len(e.Items) - 1; i >= 0; i-- {
+			tail = &Pair{toDatum(e.Items[i]), tail}
+		}
+		return tail
+	}
+
+	panic(fmt.Sprintf("unknown expression type - %T", e))
+}
+
+// toExpr converts data to an expression, it's the opposite of toDatum.
+// pos is used as the position of the expression.
+func toExpr(obj Object, pos Position) (Expression, error) {
+	switch o := obj.(type) {
+	case Number:
+		return NumberExpr{o, pos}, nil
+	case String:
+		return StringExpr{o, pos}, nil
+	case Boolean:
+		return BooleanExpr{o, pos}, nil
+	case Keyword:
+		return KeywordExpr{o, pos}, nil
+	case Symbol:
+		return SymbolExpr{Name: o, pos: pos}, nil
+	case *Vector:
+		vec := VectorExpr{pos: pos}
+		for _, item := range o.Items {
+			expr, err := toExpr(item, pos)
+			if err != nil {
+				return nil, err
+			}
+			vec.Items = append(vec.Items, expr)
+		}
+		return vec, nil
+	case *Bytevector:
+		return BytevectorExpr{bytes.Clone(o.Bytes), pos}, nil
+	case Null:
+		return ListExpr{pos: pos}, nil
+	case *Pair:
+		list := ListExpr{pos: pos}
+		for {
+			item, err := toExpr(o.Car, pos)
+			if err != nil {
+				return nil, err
+			}
+			list.Items = append(list.Items, item)
+
+			next, ok := o.Cdr.(*Pair)
+			if !ok {
+				break
+			}
+			o = next
+		}
+
+		if _, ok := o.Cdr.(Null); !ok {
+			tail, err := toExpr(o.Cdr, pos)
+			if err != nil {
+				return nil, err
+			}
+			list.Tail = tail
+		}
+		return list, nil
+	}
+
+	return nil, fmt.Errorf("can't convert %v (%s) to code", obj, typeName(obj))
+}
+
+func evalQuasiquote(args []Expression, env *Environment) (Object, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("wrong number of arguments for 'quasiquote'")
+	}
+
+	return quasi(args[0], env, 1)
+}
+
+// quasi returns quasiquoted e, where unquoted parts at nesting depth 1 are
+// evaluated
+func quasi(e Expression, env *Environment, depth int) (Object, error) {
+	if ve, ok := e.(VectorExpr); ok { // `#(1 ,x)
+		obj, err := quasi(ListExpr{Items: ve.Items, pos: ve.pos}, env, depth)
+		if err != nil {
+			return nil, err
+		}
+
+		items, err := listToSlice(obj)
+		if err != nil {
+			return nil, err
+		}
+		return &Vector{items}, nil
+	}
+
+	le, ok := e.(ListExpr)
+	if !ok {
+		return toDatum(e), nil
+	}
+
+	if name, arg, ok := quoteForm(le); ok {
+		switch name {
+		case "unquote":
+			if depth == 1 {
+				return arg.Eval(env)
+			}
+
+			inner, err := quasi(arg, env, depth-1)
+			if err != nil {
+				return nil, err
+			}
+			return NewList(name, inner), nil
+		case "quasiquote":
+			inner, err := quasi(arg, env, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			return NewList(name, inner), nil
+		}
+	}
+
+	var items []Object
+	for _, item := range le.Items {
+		if il, ok := item.(ListExpr); ok {
+			if name, arg, ok := quoteForm(il); ok && name == "unquote-splicing" {
+				if depth > 1 {
+					inner, err := quasi(arg, env, depth-1)
+					if err != nil {
+						return nil, err
+					}
+					items = append(items, NewList(name, inner))
+					continue
+				}
+
+				obj, err := arg.Eval(env)
+				if err != nil {
+					return nil, err
+				}
+
+				objs, err := listToSlice(obj)
+				if err != nil {
+					return nil, fmt.Errorf("unquote-splicing - %w", err)
+				}
+				items = append(items, objs...)
+				continue
+			}
+		}
+
+		obj, err := quasi(item, env, depth)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, obj)
+	}
+
+	var tail Object = Null{}
+	if le.Tail != nil {
+		var err error
+		if tail, err = quasi(le.Tail, env, depth); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := len(items) - 1; i >= 0; i-- {
+		tail = &Pair{items[i], tail}
+	}
+	return tail, nil
+}
+
+// quoteForm returns the name and argument of quote forms. e.g. (unquote x)
+func quoteForm(le ListExpr) (Symbol, Expression, bool) {
+	if len(le.Items) != 2 || le.Tail != nil {
+		return "", nil, false
+	}
+
+	s, ok := le.Items[0].(SymbolExpr)
+	if !ok {
+		return "", nil, false
+	}
+
+	switch name := s.baseName(); name {
+	case "quote", "quasiquote", "unquote", "unquote-splicing":
+		return name, le.Items[1], true
+	}
+	return "", nil, false
 }
 
 func evalDefine(args []Expression, env *Environment) (Object, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("wrong number of arguments for 'define'")
+	}
+
+	// (define (name params ...) body ...) → (define name (lambda (params ...) body ...))
+	// (define ((name a) b) body ...) → (define (name a) (lambda (b) body ...))
+	for {
+		le, ok := args[0].(ListExpr)
+		if !ok || len(le.Items) == 0 {
+			break
+		}
+
+		params := ListExpr{Items: le.Items[1:], Tail: le.Tail, pos: le.pos}
+		lambda := SymbolExpr{Name: "lambda", pos: le.pos}
+		body := ListExpr{Items: append([]Expression{lambda, params}, args[1:]...), pos: le.pos}
+		args = []Expression{le.Items[0], body}
+	}
+
 	if len(args) != 2 {
 		return nil, fmt.Errorf("wrong number of arguments for 'define'")
 	}
 
-	s, ok := args[0].(Symbol)
+	s, ok := args[0].(SymbolExpr)
 	if !ok {
 		return nil, fmt.Errorf("bad name in 'define'")
 	}
@@ -213,7 +846,10 @@ func evalDefine(args []Expression, env *Environment) (Object, error) {
 	if err != nil {
 		return nil, err
 	}
-	env.Set(s, val)
+	if l, ok := val.(*Lambda); ok && l.name == "" {
+		l.name = s.Name
+	}
+	env.Set(s.Name, val)
 	return val, nil
 }
 
@@ -222,14 +858,15 @@ func evalSet(args []Expression, env *Environment) (Object, error) {
 		return nil, fmt.Errorf("wrong number of arguments for 'set'")
 	}
 
-	s, ok := args[0].(Symbol)
+	s, ok := args[0].(SymbolExpr)
 	if !ok {
 		return nil, fmt.Errorf("bad name in 'set'")
 	}
 
-	env = env.Find(s)
-	if env == nil {
-		return nil, fmt.Errorf("unknown name - %s", s)
+	sym, symEnv := s.resolve(env)
+	symEnv = symEnv.Find(sym.Name)
+	if symEnv == nil {
+		return nil, &Error{Pos: s.pos, Err: &ErrorObject{"unknown name", []Object{sym.Name}}}
 	}
 
 	val, err := args[1].Eval(env)
@@ -237,7 +874,7 @@ func evalSet(args []Expression, env *Environment) (Object, error) {
 		return nil, err
 	}
 
-	env.Set(s, val)
+	symEnv.Set(sym.Name, val)
 	return val, nil
 }
 
@@ -254,131 +891,681 @@ func evalIf(args []Expression, env *Environment) (Object, error) {
 		return nil, err
 	}
 
-	if cond == 1.0 {
-		return args[1].Eval(env)
+	if isTrue(cond) {
+		return &tailCall{expr: args[1], env: env}, nil
 	}
 
 	if len(args) == 3 {
-		return args[2].Eval(env)
+		return &tailCall{expr: args[2], env: env}, nil
 	}
 
-	return Number(0.0), nil
+	return Boolean(false), nil
 }
 
-func evalOr(args []Expression, env *Environment) (Object, error) {
-	for _, e := range args {
-		obj, err := e.Eval(env)
-		if err != nil {
-			return nil, err
-		}
+// definedName returns the name defined by expr if it's a define form.
+// e.g. x for (define x 1) and f for (define (f x) x)
+func definedName(expr Expression, env *Environment) (Symbol, bool) {
+	le, ok := expr.(ListExpr)
+	if !ok || len(le.Items) < 2 || !isKeyword(le.Items[0], "define", env) {
+		return "", false
+	}
 
-		val, ok := obj.(Number)
-		if !ok {
-			return nil, fmt.Errorf("or - %v bad type %T", val, val)
+	target := le.Items[1]
+	for {
+		switch t := target.(type) {
+		case SymbolExpr:
+			return t.Name, true
+		case ListExpr:
+			if len(t.Items) == 0 {
+				return "", false
+			}
+			target = t.Items[0]
+		default:
+			return "", false
 		}
+	}
+}
 
-		if val != 0.0 {
-			return val, nil
+// evalScopeBody evaluates the body of lambda or let in its own environment.
+// Names defined at the start of the body are bound (but unassigned) before
+// evaluation, so internal definitions can refer to each other (letrec*).
+func evalScopeBody(body []Expression, env *Environment) (Object, error) {
+	for _, e := range body {
+		name, ok := definedName(e, env)
+		if !ok {
+			break
 		}
+		env.Set(name, unassigned{})
 	}
 
-	return Number(0.0), nil
+	return evalBody(body, env)
 }
 
-func evalAnd(args []Expression, env *Environment) (Object, error) {
-	for i, arg := range args {
-		obj, err := arg.Eval(env)
-		if err != nil {
+// evalBody evaluates a body of one or more expressions, the last one is in tail
+// position
+func evalBody(body []Expression, env *Environment) (Object, error) {
+	if len(body) == 0 {
+		return nil, fmt.Errorf("empty body")
+	}
+
+	last := len(body) - 1
+	for _, e := range body[:last] {
+		if _, err := e.Eval(env); err != nil {
 			return nil, err
 		}
+	}
 
-		val, ok := obj.(Number)
-		if !ok {
-			return nil, fmt.Errorf("or - %v bad type %T", val, val)
+	return &tailCall{expr: body[last], env: env}, nil
+}
+
+func evalBegin(args []Expression, env *Environment) (Object, error) {
+	if len(args) == 0 {
+		return Boolean(false), nil // unspecified
+	}
+
+	return evalBody(args, env)
+}
+
+func evalOr(args []Expression, env *Environment) (Object, error) {
+	if len(args) == 0 {
+		return Boolean(false), nil
+	}
+
+	last := len(args) - 1
+	for _, e := range args[:last] {
+		obj, err := e.Eval(env)
+		if err != nil {
+			return nil, err
 		}
 
-		if val == Number(0.0) {
-			return val, nil
+		if isTrue(obj) {
+			return obj, nil
 		}
+	}
 
-		if i == len(args)-1 {
-			return val, nil
+	return &tailCall{expr: args[last], env: env}, nil
+}
+
+func evalAnd(args []Expression, env *Environment) (Object, error) {
+	if len(args) == 0 {
+		return Boolean(true), nil
+	}
+
+	last := len(args) - 1
+	for _, arg := range args[:last] {
+		obj, err := arg.Eval(env)
+		if err != nil {
+			return nil, err
+		}
+
+		if !isTrue(obj) {
+			return obj, nil
 		}
 	}
 
-	return Number(1), nil
+	return &tailCall{expr: args[last], env: env}, nil
 }
 
 func evalLambda(args []Expression, env *Environment) (Object, error) {
-	if len(args) != 2 {
+	if len(args) < 2 {
 		return nil, fmt.Errorf("malformed lambda")
 	}
 
-	le, ok := args[0].(ListExpr)
+	l, err := parseParams(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	l.env = env
+	l.body = args[1:]
+	return l, nil
+}
+
+// parseParams parses lambda parameters to a Lambda without environment & body.
+// e.g. (a b #!optional (c 1) #:key (d 2) . rest) or args
+func parseParams(expr Expression) (*Lambda, error) {
+	l := &Lambda{}
+	if s, ok := expr.(SymbolExpr); ok { // (lambda args ...)
+		l.rest = s.Name
+		return l, nil
+	}
+
+	le, ok := expr.(ListExpr)
 	if !ok {
-		return nil, fmt.Errorf("malformed lambda")
+		return nil, fmt.Errorf("malformed lambda parameters - %s", expr)
+	}
+
+	const (
+		required = iota
+		optional
+		key
+	)
+
+	section := required
+	for _, e := range le.Items {
+		if s, ok := e.(SymbolExpr); ok && s.Name == "#!optional" {
+			if section != required {
+				return nil, fmt.Errorf("#!optional must come before #:key - %s", expr)
+			}
+			section = optional
+			continue
+		}
+
+		if k, ok := e.(KeywordExpr); ok && k.Value == "key" {
+			if section == key {
+				return nil, fmt.Errorf("duplicate #:key - %s", expr)
+			}
+			section = key
+			continue
+		}
+
+		p, err := parseParam(e, section != required)
+		if err != nil {
+			return nil, err
+		}
+
+		switch section {
+		case required:
+			l.params = append(l.params, p.name)
+		case optional:
+			l.optional = append(l.optional, p)
+		case key:
+			l.keys = append(l.keys, p)
+		}
 	}
 
-	params := make([]Symbol, len(le))
-	for i, e := range le {
-		s, ok := e.(Symbol)
+	if le.Tail != nil { // (a . rest)
+		s, ok := le.Tail.(SymbolExpr)
 		if !ok {
-			return nil, fmt.Errorf("malformed lambda")
+			return nil, fmt.Errorf("malformed rest parameter - %s", le.Tail)
 		}
-		params[i] = s
+		l.rest = s.Name
 	}
-	obj := &Lambda{
-		env:    env,
-		params: params,
-		body:   args[1],
+
+	return l, nil
+}
+
+// parseParam parses a single parameter, a name or (name default) if hasDefault
+func parseParam(expr Expression, hasDefault bool) (param, error) {
+	if s, ok := expr.(SymbolExpr); ok {
+		return param{name: s.Name}, nil
 	}
-	return obj, nil
+
+	if le, ok := expr.(ListExpr); ok && hasDefault && len(le.Items) == 2 && le.Tail == nil {
+		if s, ok := le.Items[0].(SymbolExpr); ok {
+			return param{s.Name, le.Items[1]}, nil
+		}
+	}
+
+	return param{}, fmt.Errorf("malformed lambda parameter - %s", expr)
 }
 
-// Callable object
-type Callable interface {
-	Call(args []Object) (Object, error)
+// binding is a (name value) pair in let bindings
+type binding struct {
+	name  Symbol
+	value Expression
+}
+
+// parseBindings parses let bindings. e.g. ((x 1) (y 2))
+func parseBindings(expr Expression, form string) ([]binding, error) {
+	le, ok := expr.(ListExpr)
+	if !ok || le.Tail != nil {
+		return nil, fmt.Errorf("malformed %s bindings - %s", form, expr)
+	}
+
+	bindings := make([]binding, len(le.Items))
+	seen := make(map[Symbol]bool)
+	for i, item := range le.Items {
+		b, ok := item.(ListExpr)
+		if !ok || len(b.Items) != 2 || b.Tail != nil {
+			return nil, fmt.Errorf("malformed %s binding - %s", form, item)
+		}
+
+		s, ok := b.Items[0].(SymbolExpr)
+		if !ok {
+			return nil, fmt.Errorf("malformed %s binding - %s", form, item)
+		}
+
+		// let* binds in sequence, a name can be bound again
+		if seen[s.Name] && form != "let*" {
+			return nil, fmt.Errorf("malformed %s binding - duplicate name %s", form, s.Name)
+		}
+		seen[s.Name] = true
+		bindings[i] = binding{s.Name, b.Items[1]}
+	}
+
+	return bindings, nil
+}
+
+// evalBindings evaluates binding values in env and binds them in a new
+// environment nested in parent
+func evalBindings(bindings []binding, env, parent *Environment) (*Environment, error) {
+	bindEnv := NewEnvironment(parent)
+	for _, b := range bindings {
+		val, err := b.value.Eval(env)
+		if err != nil {
+			return nil, err
+		}
+		bindEnv.Set(b.name, val)
+	}
+
+	return bindEnv, nil
+}
+
+func evalLet(args []Expression, env *Environment) (Object, error) {
+	if len(args) > 0 {
+		if s, ok := args[0].(SymbolExpr); ok {
+			return evalNamedLet(s.Name, args[1:], env)
+		}
+	}
+
+	if len(args) < 2 {
+		return nil, fmt.Errorf("malformed let")
+	}
+
+	bindings, err := parseBindings(args[0], "let")
+	if err != nil {
+		return nil, err
+	}
+
+	bodyEnv, err := evalBindings(bindings, env, env)
+	if err != nil {
+		return nil, err
+	}
+
+	return evalScopeBody(args[1:], bodyEnv)
+}
+
+// evalNamedLet evaluates (let name bindings body) where name is bound to a
+// procedure with bindings as parameters, used for loops.
+func evalNamedLet(name Symbol, args []Expression, env *Environment) (Object, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("malformed let")
+	}
+
+	bindings, err := parseBindings(args[0], "let")
+	if err != nil {
+		return nil, err
+	}
+
+	loopEnv := NewEnvironment(env)
+	loop := &Lambda{
+		name:   name,
+		env:    loopEnv,
+		params: make([]Symbol, len(bindings)),
+		body:   args[1:],
+	}
+	for i, b := range bindings {
+		loop.params[i] = b.name
+	}
+	loopEnv.Set(name, loop)
+
+	bodyEnv, err := evalBindings(bindings, env, loopEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	return evalScopeBody(args[1:], bodyEnv)
 }
 
-type begin struct{}
+// evalLetStar evaluates let*, each binding is in its own environment nested in
+// the previous one.
+func evalLetStar(args []Expression, env *Environment) (Object, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("malformed let*")
+	}
+
+	bindings, err := parseBindings(args[0], "let*")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, b := range bindings {
+		if env, err = evalBindings([]binding{b}, env, env); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(bindings) == 0 {
+		env = NewEnvironment(env)
+	}
+	return evalScopeBody(args[1:], env)
+}
+
+// unassigned is the value of letrec variables before they are initialized
+type unassigned struct{}
+
+// evalLetrec evaluates letrec and letrec*. The values are evaluated in an
+// environment where all the names are bound, so they can refer to each other.
+// letrec* assigns each value before evaluating the next one.
+func evalLetrec(args []Expression, env *Environment, form Symbol) (Object, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("malformed %s", form)
+	}
+
+	bindings, err := parseBindings(args[0], string(form))
+	if err != nil {
+		return nil, err
+	}
+
+	bodyEnv := NewEnvironment(env)
+	for _, b := range bindings {
+		bodyEnv.Set(b.name, unassigned{})
+	}
+
+	values := make([]Object, len(bindings))
+	for i, b := range bindings {
+		val, err := b.value.Eval(bodyEnv)
+		if err != nil {
+			return nil, err
+		}
+
+		if form == "letrec*" {
+			bodyEnv.Set(b.name, val)
+		}
+		values[i] = val
+	}
+
+	for i, b := range bindings {
+		bodyEnv.Set(b.name, values[i])
+	}
+
+	return evalScopeBody(args[1:], bodyEnv)
+}
+
+// isKeyword returns true if expr is the symbol name, used for syntax keywords
+// such as else and =>
+func isKeyword(expr Expression, name Symbol, env *Environment) bool {
+	s, ok := expr.(SymbolExpr)
+	if !ok {
+		return false
+	}
+
+	sym, _ := s.resolve(env)
+	return sym.Name == name
+}
+
+// parseClauses parses clauses of cond & case, the else clause must be last
+func parseClauses(args []Expression, env *Environment, form string) ([]ListExpr, error) {
+	clauses := make([]ListExpr, len(args))
+	for i, arg := range args {
+		clause, ok := arg.(ListExpr)
+		if !ok || len(clause.Items) == 0 || clause.Tail != nil {
+			return nil, fmt.Errorf("malformed %s clause - %s", form, arg)
+		}
+
+		if isKeyword(clause.Items[0], "else", env) && i < len(args)-1 {
+			return nil, fmt.Errorf("else must be the last %s clause", form)
+		}
+		clauses[i] = clause
+	}
+
+	return clauses, nil
+}
 
-// Begin function. e.g. (begin (* 3 4) (/ 5 7))
-func (b *begin) Call(args []Object) (Object, error) {
+// evalClause evaluates clause body when the clause test matched with value.
+// e.g. (test expr ...) or (test => proc)
+func evalClause(body []Expression, value Object, env *Environment, form string) (Object, error) {
+	if len(body) > 0 && isKeyword(body[0], "=>", env) {
+		if len(body) != 2 {
+			return nil, fmt.Errorf("malformed => in %s", form)
+		}
+
+		obj, err := body[1].Eval(env)
+		if err != nil {
+			return nil, err
+		}
+
+		c, ok := obj.(Callable)
+		if !ok {
+			return nil, fmt.Errorf("%s is not callable", obj)
+		}
+		return applyTail(c, []Object{value})
+	}
+
+	return evalBody(body, env)
+}
+
+func evalCond(args []Expression, env *Environment) (Object, error) {
+	clauses, err := parseClauses(args, env, "cond")
+	if err != nil {
+		return nil, err
+	}
+
+	val, _, err := evalClauses(clauses, env, "cond")
+	return val, err
+}
+
+// evalClauses evaluates cond clauses, it returns false if no clause matched
+func evalClauses(clauses []ListExpr, env *Environment, form string) (Object, bool, error) {
+	for _, clause := range clauses {
+		if isKeyword(clause.Items[0], "else", env) {
+			val, err := evalBody(clause.Items[1:], env)
+			return val, true, err
+		}
+
+		val, err := clause.Items[0].Eval(env)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if !isTrue(val) {
+			continue
+		}
+
+		if len(clause.Items) == 1 { // (cond ((assoc 'a alist)))
+			return val, true, nil
+		}
+
+		val, err = evalClause(clause.Items[1:], val, env, form)
+		return val, true, err
+	}
+
+	return Boolean(false), false, nil
+}
+
+func evalCase(args []Expression, env *Environment) (Object, error) {
 	if len(args) == 0 {
-		return 0.0, nil
+		return nil, fmt.Errorf("malformed case")
+	}
+
+	key, err := args[0].Eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	clauses, err := parseClauses(args[1:], env, "case")
+	if err != nil {
+		return nil, err
 	}
 
-	return args[len(args)-1], nil
+	for _, clause := range clauses {
+		if len(clause.Items) < 2 {
+			return nil, fmt.Errorf("malformed case clause - %s", clause)
+		}
+
+		if isKeyword(clause.Items[0], "else", env) {
+			return evalClause(clause.Items[1:], key, env, "case")
+		}
+
+		data, ok := clause.Items[0].(ListExpr)
+		if !ok || data.Tail != nil {
+			return nil, fmt.Errorf("malformed case clause - %s", clause)
+		}
+
+		for _, d := range data.Items {
+			if isEqv(key, toDatum(d)) {
+				return evalClause(clause.Items[1:], key, env, "case")
+			}
+		}
+	}
+
+	return Boolean(false), nil
+}
+
+// evalWhen evaluates when (onTrue is true) and unless (onTrue is false)
+func evalWhen(args []Expression, env *Environment, onTrue bool) (Object, error) {
+	if len(args) < 2 {
+		if onTrue {
+			return nil, fmt.Errorf("malformed when")
+		}
+		return nil, fmt.Errorf("malformed unless")
+	}
+
+	val, err := args[0].Eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	if isTrue(val) != onTrue {
+		return Boolean(false), nil
+	}
+	return evalBody(args[1:], env)
+}
+
+// doVar is a variable in do. e.g. (i 0 (+ i 1))
+type doVar struct {
+	name Symbol
+	init Expression
+	step Expression // nil if no step
+}
+
+func parseDoVars(expr Expression) ([]doVar, error) {
+	le, ok := expr.(ListExpr)
+	if !ok || le.Tail != nil {
+		return nil, fmt.Errorf("malformed do variables - %s", expr)
+	}
+
+	vars := make([]doVar, len(le.Items))
+	for i, item := range le.Items {
+		spec, ok := item.(ListExpr)
+		if !ok || spec.Tail != nil || len(spec.Items) < 2 || len(spec.Items) > 3 {
+			return nil, fmt.Errorf("malformed do variable - %s", item)
+		}
+
+		s, ok := spec.Items[0].(SymbolExpr)
+		if !ok {
+			return nil, fmt.Errorf("malformed do variable - %s", item)
+		}
+
+		vars[i] = doVar{name: s.Name, init: spec.Items[1]}
+		if len(spec.Items) == 3 {
+			vars[i].step = spec.Items[2]
+		}
+	}
+
+	return vars, nil
+}
+
+// evalDo evaluates (do ((var init step) ...) (test expr ...) command ...).
+// Each iteration gets a new environment, so closures capture the current
+// values.
+func evalDo(args []Expression, env *Environment) (Object, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("malformed do")
+	}
+
+	vars, err := parseDoVars(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	test, ok := args[1].(ListExpr)
+	if !ok || len(test.Items) == 0 || test.Tail != nil {
+		return nil, fmt.Errorf("malformed do test - %s", args[1])
+	}
+
+	loopEnv := NewEnvironment(env)
+	for _, v := range vars {
+		val, err := v.init.Eval(env)
+		if err != nil {
+			return nil, err
+		}
+		loopEnv.Set(v.name, val)
+	}
+
+	for {
+		done, err := test.Items[0].Eval(loopEnv)
+		if err != nil {
+			return nil, err
+		}
+
+		if isTrue(done) {
+			if len(test.Items) == 1 {
+				return Boolean(false), nil
+			}
+			return evalBody(test.Items[1:], loopEnv)
+		}
+
+		for _, cmd := range args[2:] {
+			if _, err := cmd.Eval(loopEnv); err != nil {
+				return nil, err
+			}
+		}
+
+		next := NewEnvironment(env)
+		for _, v := range vars {
+			val := loopEnv.Get(v.name)
+			if v.step != nil {
+				if val, err = v.step.Eval(loopEnv); err != nil {
+					return nil, err
+				}
+			}
+			next.Set(v.name, val)
+		}
+		loopEnv = next
+	}
+}
+
+// Callable object
+type Callable interface {
+	Call(args []Object) (Object, error)
 }
 
 // Function object
 type Function struct {
-	name  string
-	nargs int
-	op    func(args []Number) (Object, error)
+	name    string
+	minArgs int
+	maxArgs int // -1 for any number of arguments
+	op      func(args []Object) (Object, error)
 }
 
 // Call implement Callable
 func (f *Function) Call(args []Object) (Object, error) {
-	if f.nargs != 0 && len(args) != f.nargs {
-		return nil, f.errorf("wrong number of arguments (want %d, got %d)", f.nargs, len(args))
+	if len(args) < f.minArgs || (f.maxArgs >= 0 && len(args) > f.maxArgs) {
+		return nil, f.errorf("wrong number of arguments (want %s, got %d)", f.arity(), len(args))
 	}
 
-	var vals []Number
-	for i, obj := range args {
-		val, ok := obj.(Number)
-		if !ok {
-			return nil, f.errorf("argument %d: got %v of type %T", i, obj, obj)
+	val, err := f.op(args)
+	if err != nil {
+		if passThrough(err) {
+			return nil, err
 		}
-		vals = append(vals, val)
+		return nil, fmt.Errorf("%s - %w", f.name, err)
 	}
 
-	val, err := f.op(vals)
-	if err != nil {
-		return nil, f.errorf("%s", err)
+	return val, nil
+}
+
+// arity returns the number of arguments f accepts. e.g. "2", "1 to 3"
+func (f *Function) arity() string {
+	switch f.maxArgs {
+	case f.minArgs:
+		return strconv.Itoa(f.minArgs)
+	case -1:
+		return fmt.Sprintf("at least %d", f.minArgs)
 	}
+	return fmt.Sprintf("%d to %d", f.minArgs, f.maxArgs)
+}
 
-	return val, nil
+// passThrough returns true if err should pass through functions unchanged.
+// These are errors from lisp code called by the function, which already have a
+// position, continuation escapes and raised objects.
+func passThrough(err error) bool {
+	var perr *Error
+	var esc *escape
+	var r *raised
+	return errors.As(err, &perr) || errors.As(err, &esc) || errors.As(err, &r)
 }
 
 func (f *Function) errorf(format string, args ...any) error {
@@ -386,195 +1573,299 @@ func (f *Function) errorf(format string, args ...any) error {
 	return fmt.Errorf("%s - %s", f.name, msg)
 }
 
+// numeric adapts op, that works on numbers, to a Function op
+func numeric(op func(args []Number) (Object, error)) func(args []Object) (Object, error) {
+	return func(args []Object) (Object, error) {
+		vals := make([]Number, len(args))
+		for i := range args {
+			val, err := numberArg(args, i)
+			if err != nil {
+				return nil, err
+			}
+			vals[i] = val
+		}
+
+		return op(vals)
+	}
+}
+
+// argError returns an error for argument i of wrong type
+func argError(args []Object, i int) error {
+	return fmt.Errorf("argument %d: got %v of type %T", i, args[i], args[i])
+}
+
+func numberArg(args []Object, i int) (Number, error) {
+	val, ok := args[i].(Number)
+	if !ok {
+		return nil, argError(args, i)
+	}
+	return val, nil
+}
+
+// intArg returns argument i as an int, it must be an exact integer
+func intArg(args []Object, i int) (int, error) {
+	val, err := numberArg(args, i)
+	if err != nil {
+		return 0, err
+	}
+
+	n, ok := val.(Integer)
+	if !ok || Integer(int(n)) != n {
+		return 0, fmt.Errorf("argument %d: %v is not an exact integer", i, val)
+	}
+	return int(n), nil
+}
+
+func stringArg(args []Object, i int) (String, error) {
+	val, ok := args[i].(String)
+	if !ok {
+		return "", argError(args, i)
+	}
+	return val, nil
+}
+
 // Lambda is a lambda object. e.g. (lambda (n) (+ n 1))
 type Lambda struct {
-	env    *Environment
-	params []Symbol
-	body   Expression
+	name     Symbol // set by define, used in error messages
+	env      *Environment
+	params   []Symbol // required parameters
+	optional []param  // #!optional parameters
+	keys     []param  // #:key parameters
+	rest     Symbol   // rest of arguments, empty if none
+	body     []Expression
+}
+
+// param is an optional or keyword parameter. e.g. (width 10)
+type param struct {
+	name  Symbol
+	value Expression // default value, #f if nil
 }
 
 // Call implements Callable
 func (l *Lambda) Call(args []Object) (Object, error) {
-	if len(args) != len(l.params) {
-		return nil, fmt.Errorf("wrong number of arguments (want %d, got %d)", len(l.params), args)
+	env, err := l.bind(args)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := force(evalScopeBody(l.body, env))
+	if err != nil {
+		addFrame(err, l.displayName(), Position{}) // call site is set by the caller
+		return nil, err
+	}
+	return obj, nil
+}
+
+// bind returns a new environment for the lambda body with params bound to args
+func (l *Lambda) bind(args []Object) (*Environment, error) {
+	env := NewEnvironment(l.env)
+	if len(args) < len(l.params) {
+		return nil, l.arityError(len(args))
 	}
 
-	m := make(map[Symbol]Object)
 	for i, name := range l.params {
-		m[name] = args[i]
+		env.Set(name, args[i])
 	}
+	args = args[len(l.params):]
 
-	env := &Environment{m, l.env}
-	return l.body.Eval(env)
-}
+	for _, p := range l.optional {
+		if len(args) == 0 || (len(l.keys) > 0 && isKeywordArg(args[0])) {
+			if err := p.bindDefault(env); err != nil {
+				return nil, err
+			}
+			continue
+		}
 
-func (l *Lambda) String() string {
-	var buf bytes.Buffer
-	fmt.Fprintf(&buf, "(lambda (")
-	// Can't use strings.Join on []Symbol
-	for i, sym := range l.params {
-		fmt.Fprint(&buf, sym)
-		if i < len(l.params)-1 {
-			fmt.Fprint(&buf, " ")
+		env.Set(p.name, args[0])
+		args = args[1:]
+	}
+
+	if len(l.keys) > 0 {
+		if err := l.bindKeys(args, env); err != nil {
+			return nil, err
 		}
 	}
-	fmt.Fprintf(&buf, ") ")
-	fmt.Fprintf(&buf, "%s", l.body)
-	fmt.Fprint(&buf, ")")
-	return buf.String()
+
+	switch {
+	case l.rest != "":
+		env.Set(l.rest, NewList(args...))
+	case len(args) > 0 && len(l.keys) == 0:
+		return nil, l.arityError(len(l.params) + len(l.optional) + len(args))
+	}
+
+	return env, nil
 }
 
-// ReadExpr reads an expression from slice of tokens
-func ReadExpr(tokens []Token) (Expression, []Token, error) {
-	var err error
-	if len(tokens) == 0 {
-		return nil, nil, io.EOF
+// bindKeys binds keyword parameters from #:name value pairs in args
+func (l *Lambda) bindKeys(args []Object, env *Environment) error {
+	values := make(map[Keyword]Object)
+	for _, p := range l.keys {
+		values[Keyword(p.name)] = nil
 	}
 
-	tok, tokens := tokens[0], tokens[1:]
-	if tok == "(" {
-		var children []Expression
-		for len(tokens) > 0 && tokens[0] != ")" {
-			var child Expression
-			child, tokens, err = ReadExpr(tokens)
-			if err != nil {
-				return nil, nil, err
+	for ; len(args) > 0; args = args[2:] {
+		k, ok := args[0].(Keyword)
+		if !ok {
+			if l.rest != "" { // extra arguments go to rest
+				break
 			}
-			children = append(children, child)
+			return fmt.Errorf("%s - expected keyword argument, got %v", l.displayName(), args[0])
 		}
 
-		if len(tokens) == 0 {
-			return nil, nil, fmt.Errorf("unbalanced expression")
+		if _, ok := values[k]; !ok && l.rest == "" {
+			return fmt.Errorf("%s - unknown keyword argument %s (want %s)", l.displayName(), k, l.signature())
 		}
 
-		tokens = tokens[1:] // remove closing ')'
-		return ListExpr(children), tokens, nil
+		if len(args) == 1 {
+			return fmt.Errorf("%s - missing value for keyword argument %s", l.displayName(), k)
+		}
+		values[k] = args[1]
 	}
 
-	switch tok {
-	case ")": // TODO: file:line
-		return nil, nil, fmt.Errorf("unexpected ')'")
-	}
+	for _, p := range l.keys {
+		if val := values[Keyword(p.name)]; val != nil {
+			env.Set(p.name, val)
+			continue
+		}
 
-	lit := string(tok)
-	val, err := strconv.ParseFloat(lit, 64)
-	if err == nil {
-		return NumberExpr(val), tokens, nil
+		if err := p.bindDefault(env); err != nil {
+			return err
+		}
 	}
-	return Symbol(lit), tokens, nil // name
+
+	return nil
 }
 
-// Environment holds name → values
-type Environment struct {
-	bindings map[Symbol]Object
-	parent   *Environment
+// isKeywordArg returns true if obj is a keyword argument. e.g. #:width
+func isKeywordArg(obj Object) bool {
+	_, ok := obj.(Keyword)
+	return ok
 }
 
-// Find finds the environment holding name, return nil if not found
-func (e *Environment) Find(name Symbol) *Environment {
-	if _, ok := e.bindings[name]; ok {
-		return e
+// bindDefault binds p to its default value, evaluated in env so it can refer
+// to previous parameters
+func (p param) bindDefault(env *Environment) error {
+	if p.value == nil {
+		env.Set(p.name, Boolean(false))
+		return nil
 	}
 
-	if e.parent == nil {
-		return nil
+	val, err := p.value.Eval(env)
+	if err != nil {
+		return err
 	}
-	return e.parent.Find(name)
+	env.Set(p.name, val)
+	return nil
 }
 
-// Get returns bindings for name in environment
-func (e *Environment) Get(name Symbol) Object {
-	return e.bindings[name]
+func (l *Lambda) arityError(n int) error {
+	return fmt.Errorf("%s - wrong number of arguments (want %s, got %d)", l.displayName(), l.signature(), n)
 }
 
-// Set sets bindings for name
-func (e *Environment) Set(name Symbol, value Object) {
-	e.bindings[name] = value
+// displayName returns the lambda name for error messages
+func (l *Lambda) displayName() string {
+	if l.name == "" {
+		return "lambda"
+	}
+	return string(l.name)
 }
 
-func repl() {
-	rdr := bufio.NewReader(os.Stdin)
-	for {
-		fmt.Printf("» ")
-		text, err := rdr.ReadString('\n')
-		if err != nil {
-			break
-		}
-
-		text = strings.TrimSpace(text)
-		if len(text) == 0 {
-			continue
-		}
+// paramsString returns the lambda parameters as they appear in code
+func (l *Lambda) paramsString() string {
+	if len(l.params) == 0 && len(l.optional) == 0 && len(l.keys) == 0 && l.rest != "" {
+		return string(l.rest)
+	}
 
-		tokens := Tokenize(text)
-		// fmt.Println("tokens →", tokens)
+	var parts []string
+	for _, p := range l.params {
+		parts = append(parts, string(p))
+	}
 
-		expr, _, err := ReadExpr(tokens)
-		if err != nil {
-			printError(err)
-			continue
+	if len(l.optional) > 0 {
+		parts = append(parts, "#!optional")
+		for _, p := range l.optional {
+			parts = append(parts, p.String())
 		}
-		//fmt.Printf("expr → %s\n", expr)
+	}
 
-		out, err := expr.Eval(builtins)
-		if err != nil {
-			printError(err)
-			continue
+	if len(l.keys) > 0 {
+		parts = append(parts, "#:key")
+		for _, p := range l.keys {
+			parts = append(parts, p.String())
 		}
-		fmt.Println(out)
 	}
+
+	if l.rest != "" {
+		parts = append(parts, ".", string(l.rest))
+	}
+
+	return "(" + strings.Join(parts, " ") + ")"
 }
 
-func printError(err error) {
-	fmt.Fprintf(os.Stderr, "\033[31mERROR: %s\033[0m\n", err)
+func (p param) String() string {
+	if p.value == nil {
+		return string(p.name)
+	}
+	return fmt.Sprintf("(%s %s)", p.name, p.value)
 }
 
-func runFile(fileName string) error {
-	data, err := os.ReadFile(fileName)
-	if err != nil {
-		return err
+// signature returns the lambda call signature. e.g. (add a b . rest)
+func (l *Lambda) signature() string {
+	params := l.paramsString()
+	switch {
+	case params == "()":
+		return fmt.Sprintf("(%s)", l.displayName())
+	case strings.HasPrefix(params, "("):
+		return fmt.Sprintf("(%s %s", l.displayName(), params[1:])
 	}
+	return fmt.Sprintf("(%s . %s)", l.displayName(), params)
+}
 
-	tokens := Tokenize(string(data))
+func (l *Lambda) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "(lambda %s", l.paramsString())
+	for _, e := range l.body {
+		fmt.Fprintf(&buf, " %s", e)
+	}
+	fmt.Fprint(&buf, ")")
+	return buf.String()
+}
 
-	for len(tokens) > 0 {
-		var expr Expression
-		var err error
-		expr, tokens, err = ReadExpr(tokens)
-		if err != nil {
-			return err
-		}
+// Environment holds name → values
+type Environment struct {
+	bindings map[Symbol]Object
+	parent   *Environment
+	interp   *Interpreter // owner of the environment, used by guard
+}
 
-		_, err = expr.Eval(builtins)
-		if err != nil {
-			return err
-		}
+// NewEnvironment returns a new empty environment, nested in parent (which can
+// be nil)
+func NewEnvironment(parent *Environment) *Environment {
+	env := &Environment{bindings: make(map[Symbol]Object), parent: parent}
+	if parent != nil {
+		env.interp = parent.interp
 	}
-	return nil
+	return env
 }
 
-// rlwrap go run humble.go
-func main() {
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "usage: %s [FILE]\n", path.Base(os.Args[0]))
-		fmt.Fprintln(os.Stderr, "Without a file will invoke REPL.")
-		flag.PrintDefaults()
+// Find finds the environment holding name, return nil if not found
+func (e *Environment) Find(name Symbol) *Environment {
+	if _, ok := e.bindings[name]; ok {
+		return e
 	}
-	flag.Parse()
 
-	switch flag.NArg() {
-	case 0:
-		fmt.Println("Welcome to Hubmle lisp (hit CTRL-D to quit)")
-		repl()
-		fmt.Println("\nkthxbai ☺")
-	case 1:
-		err := runFile(flag.Arg(0))
-		if err != nil {
-			printError(err)
-			os.Exit(1)
-		}
-	default:
-		fmt.Fprintln(os.Stderr, "error: wrong number of arguments.")
-		os.Exit(1)
+	if e.parent == nil {
+		return nil
 	}
+	return e.parent.Find(name)
+}
+
+// Get returns bindings for name in environment
+func (e *Environment) Get(name Symbol) Object {
+	return e.bindings[name]
+}
+
+// Set sets bindings for name
+func (e *Environment) Set(name Symbol, value Object) {
+	e.bindings[name] = value
 }
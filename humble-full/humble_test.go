@@ -1,18 +1,17 @@
-package main
+package humble
 
 import (
-	"os"
+	"errors"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"strings"
 	"testing"
 )
 
-func run(t *testing.T, code string) Object {
-	tokens := Tokenize(code)
-	expr, _, err := ReadExpr(tokens)
-	if err != nil {
-		t.Fatalf("read expression: %s", err)
-	}
-
-	obj, err := expr.Eval(builtins)
+// run evaluates all expressions in code with interp, returns value of last one
+func run(t *testing.T, interp *Interpreter, code string) Object {
+	obj, err := interp.eval(strings.NewReader(code), "<test>")
 	if err != nil {
 		t.Fatalf("eval: %s", err)
 	}
@@ -25,20 +24,19 @@ var evalTestCases = []struct {
 	expr     string
 	out      Object
 }{
-	{"fact.scm", "(fact 10)", Number(3628800.0)},
-	{"collatz.scm", "(collatz 7)", Number(22.0)},
+	{"fact.scm", "(fact 10)", Integer(3628800)},
+	{"collatz.scm", "(collatz 7)", Integer(22)},
 }
 
 func TestEval(t *testing.T) {
 	for _, tc := range evalTestCases {
 		t.Run(tc.fileName, func(t *testing.T) {
-			data, err := os.ReadFile(tc.fileName)
-			if err != nil {
-				t.Fatal("open")
+			interp := New()
+			if _, err := interp.Load(tc.fileName); err != nil {
+				t.Fatal(err)
 			}
-			run(t, string(data))
 
-			out := run(t, tc.expr)
+			out := run(t, interp, tc.expr)
 			if tc.out != out {
 				t.Fatalf("result mismatch: %#v != %#v", tc.out, out)
 			}
@@ -50,20 +48,32 @@ var logicTestCases = []struct {
 	expr string
 	out  Object
 }{
-	{"(or)", Number(0.0)},
-	{"(or 1 2)", Number(1.0)},
-	{"(or 0 2 1)", Number(2.0)},
-	{"(or 1 (% 1 0))", Number(1.0)}, // short circuit
-	{"(and)", Number(1.0)},
-	{"(and 1 2)", Number(2.0)},
-	{"(and 1 0 3)", Number(0.0)},
-	{"(and 0 (% 1 0))", Number(0.0)}, // short circuit
+	{"(or)", Boolean(false)},
+	{"(or 1 2)", Integer(1)},
+	{"(or #f 2 1)", Integer(2)},
+	{"(or 0 2)", Integer(0)}, // only #f is false
+	{"(or #f #f)", Boolean(false)},
+	{"(or 1 (% 1 0))", Integer(1)}, // short circuit
+	{"(and)", Boolean(true)},
+	{"(and 1 2)", Integer(2)},
+	{"(and 1 #f 3)", Boolean(false)},
+	{"(and 1 0 3)", Integer(3)},
+	{"(and #f (% 1 0))", Boolean(false)}, // short circuit
+	{"(if 2 1 0)", Integer(1)},
+	{"(if 0 1 0)", Integer(1)},
+	{`(if "" 1 0)`, Integer(1)},
+	{"(if #f 1 0)", Integer(0)},
+	{"(if (< 1 2) #t #f)", Boolean(true)},
+	{"(not 0)", Boolean(false)},
+	{"(not #f)", Boolean(true)},
+	{"(eq? #t #true)", Boolean(true)},
+	{`(eq? "a" 1)`, Boolean(false)},
 }
 
 func TestLogic(t *testing.T) {
 	for _, tc := range logicTestCases {
 		t.Run(tc.expr, func(t *testing.T) {
-			out := run(t, tc.expr)
+			out := run(t, New(), tc.expr)
 			if tc.out != out {
 				t.Fatalf("result mismatch: %#v != %#v", tc.out, out)
 			}
@@ -71,9 +81,451 @@ func TestLogic(t *testing.T) {
 	}
 }
 
-func TestRunFile(t *testing.T) {
-	err := runFile("fact.scm")
+func TestTailCalls(t *testing.T) {
+	// Make sure tail calls don't grow the stack
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+
+	code := `
+(define steps
+  (lambda (n count)
+    (if (eq? n 1)
+	count
+	(steps (if (eq? (% n 2) 0) (/ n 2) (+ (* n 3) 1)) (+ count 1)))))
+
+(define loop
+  (lambda (n)
+    (or (eq? n 0)
+	(and #t (loop (- n 1))))))
+
+(define loop-cond
+  (lambda (n)
+    (cond ((eq? n 0) #t)
+	  ((eq? (% n 2) 0) (loop-cond (- n 1)))
+	  (else (case n ((1) (loop-cond 0)) (else (when #t (loop-cond (- n 1)))))))))
+
+(loop 300000)
+(loop-cond 300000)
+(let loop ((i 0)) (unless (eq? i 300000) (loop (+ i 1))))
+(define loop-begin (lambda (n) (begin 'skip (if (eq? n 0) #t (loop-begin (- n 1))))))
+(loop-begin 300000)
+(steps 27 0)
+`
+	out := run(t, New(), code)
+	if out != Integer(111) {
+		t.Fatalf("result mismatch: %#v != %#v", out, Integer(111))
+	}
+}
+
+func TestLoad(t *testing.T) {
+	out, err := New().Load("fact.scm")
 	if err != nil {
 		t.Fatal(err)
 	}
+
+	if out != Integer(3628800) {
+		t.Fatalf("result mismatch: %#v != %#v", out, Integer(3628800))
+	}
+}
+
+func TestIsolation(t *testing.T) {
+	interp1, interp2 := New(), New()
+	run(t, interp1, "(define x 1) (set! + -)")
+
+	if _, err := interp2.Eval("x"); err == nil {
+		t.Fatal("definition leaked to other interpreter")
+	}
+
+	if out := run(t, interp2, "(+ 3 2)"); out != Integer(5) {
+		t.Fatalf("set! leaked to other interpreter: (+ 3 2) → %v", out)
+	}
+}
+
+// errorTestCase is code that should fail with err
+type errorTestCase struct {
+	code string
+	err  string
+}
+
+// testErrors checks that evaluating each case fails with the case error
+func testErrors(t *testing.T, cases []errorTestCase) {
+	for _, tc := range cases {
+		t.Run(tc.code, func(t *testing.T) {
+			_, err := New().eval(strings.NewReader(tc.code), "<test>")
+			if err == nil {
+				t.Fatal("no error")
+			}
+
+			if err.Error() != tc.err {
+				t.Fatalf("error mismatch: %q != %q", err.Error(), tc.err)
+			}
+		})
+	}
+}
+
+var errorTestCases = []errorTestCase{
+	{"(+ 1\n  fo)", "<test>:2:3: unknown name - fo"},
+	{"(define x 1)\n(+ x", "<test>:2:1: unbalanced expression"},
+	{`(print "hi\n)`, "<test>:1:8: unterminated string"},
+	{`"\q"`, `<test>:1:2: unknown escape - \q`},
+	{`(substring "abc" 2 1)`, "<test>:1:1: substring - bad range [2:1] for string of length 3"},
+	{"(car '())", "<test>:1:1: car - argument 0: got () of type humble.Null"},
+	{"(list-ref '(1) 1)", "<test>:1:1: list-ref - index 1 out of range for list of length 1"},
+	{"'(1 . 2 3)", "<test>:1:9: bad dotted list"},
+	{"#(1 . 2)", "<test>:1:5: bad vector literal"},
+	{"#u8(1\n 256)", "<test>:2:2: bad bytevector item - 256"},
+	{"#(1 2", "<test>:1:1: unbalanced expression"},
+	{"(vector-ref #(1 2) 2)", "<test>:1:1: vector-ref - index 2 out of range for vector of length 2"},
+	{"(+ 1\n  1_000)", "<test>:2:3: bad number literal - 1_000"},
+	{"(list 0x1p3)", "<test>:1:7: bad number literal - 0x1p3"},
+	{"#xZZ", "<test>:1:1: bad number literal - #xZZ"},
+	{"#e+inf.0", "<test>:1:1: bad number literal - #e+inf.0"},
+	{"(1 . 2)", "<test>:1:1: dotted list in expression"},
+	{"  )", "<test>:1:3: unexpected ')' without matching '('"},
+	{"(define p (list 1 2)) (set-cdr! (cdr p) p) (length p)", "<test>:1:44: length - argument 0: circular list"},
+	{"(define p (list 1)) (set-cdr! p p) (member 2 p)", "<test>:1:36: member - argument 1: circular list"},
+	{"(if 1)", "<test>:1:1: wrong number of arguments for 'if'"},
+	{"((lambda (n) n) 1 2)", "<test>:1:1: lambda - wrong number of arguments (want (lambda n), got 2)"},
+	{"(define (f a #!optional b . r) a) (f)", "<test>:1:35: f - wrong number of arguments (want (f a #!optional b . r), got 0)"},
+	{"(define (f #:key (x 1)) x) (f #:y 2)", "<test>:1:28: f - unknown keyword argument #:y (want (f #:key (x 1)))"},
+	{"(define (f #:key x) x) (f #:x)", "<test>:1:24: f - missing value for keyword argument #:x"},
+	{"(define (f #:key x) x) (f 1)", "<test>:1:24: f - expected keyword argument, got 1"},
+	{"(lambda (a (b 1)) a)", "<test>:1:1: malformed lambda parameter - (b 1)"},
+	{"(-)", "<test>:1:1: - - wrong number of arguments (want at least 1, got 0)"},
+	{"; comment\n(- 1\n   ; (\n   ((lambda (x) y) 2))", "<test>:4:17: unknown name - y"},
+	{"(let ((x 1) y) x)", "<test>:1:1: malformed let binding - y"},
+	{"(let ((x 1) (x 2)) x)", "<test>:1:1: malformed let binding - duplicate name x"},
+	{"(letrec ((f 1) (f 2)) f)", "<test>:1:1: malformed letrec binding - duplicate name f"},
+	{"(let loop ((i 1) (i 2)) i)", "<test>:1:1: malformed let binding - duplicate name i"},
+	{"(let* x 1)", "<test>:1:1: malformed let* bindings - x"},
+	{"(let ((x 1)))", "<test>:1:1: malformed let"},
+	{"(letrec ((a b) (b 1)) a)", `<test>:1:13: "b" used before initialization`},
+	{"(cond (else 1) (#t 2))", "<test>:1:1: else must be the last cond clause"},
+	{"(cond 1)", "<test>:1:1: malformed cond clause - 1"},
+	{"(case 1 (1 'one))", "<test>:1:1: malformed case clause - (1 (quote one))"},
+	{"(do ((i 0 1 2)) (#t))", "<test>:1:1: malformed do variable - (i 0 1 2)"},
+	{"(define (f) (define a b) (define b 1) a) (f)", `<test>:1:23: "b" used before initialization`},
+	{"(define (f))", "<test>:1:1: wrong number of arguments for 'define'"},
+	{"(define (1 x) x)", "<test>:1:1: bad name in 'define'"},
+}
+
+func TestErrors(t *testing.T) {
+	testErrors(t, errorTestCases)
+}
+
+func TestReaderStream(t *testing.T) {
+	// Reader should not need the whole input to read an expression
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go func() {
+		io.WriteString(pw, "(+ 1\n")
+		io.WriteString(pw, "  2) (* 3")
+	}()
+
+	rdr := NewReader(pr, "<pipe>")
+	expr, err := rdr.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := New().EvalExpr(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out != Integer(3) {
+		t.Fatalf("result mismatch: %#v != %#v", out, Integer(3))
+	}
+}
+
+var stringTestCases = []struct {
+	expr string
+	out  string
+}{
+	{`"hello world"`, `"hello world"`},
+	{`"a\tb\n\"c\"\\"`, `"a\tb\n\"c\"\\"`},
+	{`"\x41;\x3bb;"`, `"Aλ"`},
+	{`(string-length "λx")`, "2"},
+	{`(string-append "a" "bc" "")`, `"abc"`},
+	{`(substring "hello" 1 3)`, `"el"`},
+	{`(substring "hello" 2)`, `"llo"`},
+	{`(string-upcase "Hi")`, `"HI"`},
+	{`(string-index "λhello" "ll")`, "3"},
+	{`(string-index "hello" "x")`, "#f"},
+	{`(string-split " a b  c ")`, `("a" "b" "c")`},
+	{`(string-split "a,b" ",")`, `("a" "b")`},
+	{`(string-join (string-split "a b c") ", ")`, `"a, b, c"`},
+	{`(string->number "2.5")`, "2.5"},
+	{`(number->string 10)`, `"10"`},
+	{`(string->number "x")`, "#f"},
+	{`(string=? "a" "a")`, "#t"},
+}
+
+func TestStrings(t *testing.T) {
+	for _, tc := range stringTestCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			out := fmt.Sprint(run(t, New(), tc.expr))
+			if tc.out != out {
+				t.Fatalf("result mismatch: %s != %s", tc.out, out)
+			}
+		})
+	}
+}
+
+var listTestCases = []struct {
+	expr string
+	out  string
+}{
+	{"'x", "x"},
+	{"'(1 (\"a\" b) . c)", `(1 ("a" b) . c)`},
+	{"(quote ())", "()"},
+	{"''x", "(quote x)"},
+	{"(cons 1 2)", "(1 . 2)"},
+	{"(cons 1 '())", "(1)"},
+	{"(car '(1 2))", "1"},
+	{"(cdr '(1 2))", "(2)"},
+	{"(list 1 (+ 1 1) 'c)", "(1 2 c)"},
+	{"(null? '())", "#t"},
+	{"(null? '(1))", "#f"},
+	{"(pair? '(1))", "#t"},
+	{"(pair? '())", "#f"},
+	{"(length '(1 2 3))", "3"},
+	{"(append '(1) '() '(2 3) '(4 . 5))", "(1 2 3 4 . 5)"},
+	{"(append)", "()"},
+	{"(reverse '(1 2 3))", "(3 2 1)"},
+	{"(list-ref '(a b c) 1)", "b"},
+	{"(assoc \"b\" '((\"a\" . 1) (\"b\" . 2)))", `("b" . 2)`},
+	{"(assoc 'c '((a 1) (b 2)))", "#f"},
+	{"(member '(2) '(1 (2) 3))", "((2) 3)"},
+	{"(member 4 '(1 2 3))", "#f"},
+	{"(equal? '(1 (2)) (list 1 (list 2)))", "#t"},
+	{"(eq? '(1) '(1))", "#f"},
+	// Circular lists
+	{"(define p (list 1 2)) (set-cdr! (cdr p) p) (list? p)", "#f"},
+	{"(define p (list 1 2 3)) (set-cdr! (cdr (cdr p)) p) (list? p)", "#f"},
+	{"(define p (list 1)) (set-cdr! p p) (equal? p p)", "#t"},
+	{"(define p (list 1)) (set-cdr! p p) (define q (list 1 1)) (set-cdr! (cdr q) q) (equal? p q)", "#t"},
+	{"(define p (list 1 2)) (set-cdr! (cdr p) p) p", "(1 2 ...)"},
+	{"(define p (list 1)) (set-car! p p) p", "(...)"},
+	{"(define p (list 1)) (set-cdr! p p) (member 1 p)", "(1 ...)"},
+}
+
+func TestLists(t *testing.T) {
+	for _, tc := range listTestCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			out := fmt.Sprint(run(t, New(), tc.expr))
+			if tc.out != out {
+				t.Fatalf("result mismatch: %s != %s", tc.out, out)
+			}
+		})
+	}
+}
+
+var letTestCases = []struct {
+	code string
+	out  string
+}{
+	{"(let ((x 1) (y 2)) (+ x y))", "3"},
+	{"(let () 7)", "7"},
+	{"(define x 1) (let ((x 10) (y x)) y)", "1"},
+	{"(let ((x 1)) (let ((x 2)) x))", "2"},
+	{"(let* ((x 1) (y (+ x 1))) (* x y))", "2"},
+	{"(let* ((x 1) (x (+ x 1))) x)", "2"},
+	{"(define x 1) (let* ((x 10) (y x)) y)", "10"},
+	{`(letrec ((ev? (lambda (n) (if (eq? n 0) #t (od? (- n 1)))))
+	           (od? (lambda (n) (if (eq? n 0) #f (ev? (- n 1))))))
+	    (ev? 100))`, "#t"},
+	{"(letrec* ((a 1) (b (+ a 1))) b)", "2"},
+	{"(let loop ((i 0) (acc '())) (if (eq? i 3) acc (loop (+ i 1) (cons i acc))))", "(2 1 0)"},
+	// Closures capture the binding environment
+	{"(define f (let ((n 0)) (lambda () (begin (set! n (+ n 1)) n)))) (f) (f)", "2"},
+}
+
+func TestLet(t *testing.T) {
+	for _, tc := range letTestCases {
+		t.Run(tc.code, func(t *testing.T) {
+			out := fmt.Sprint(run(t, New(), tc.code))
+			if tc.out != out {
+				t.Fatalf("result mismatch: %s != %s", tc.out, out)
+			}
+		})
+	}
+}
+
+var controlTestCases = []struct {
+	code string
+	out  string
+}{
+	{"(cond ((< 1 0) 'neg) ((< 0 1) 'pos) (else 'zero))", "pos"},
+	{"(cond ((< 1 0) 'neg) (else 'zero))", "zero"},
+	{"(cond ((< 1 0) 'neg))", "#f"},
+	{"(cond ((assoc 'b '((a 1) (b 2))) => cadr-ish) (else 'none))", "2"},
+	{"(cond ((assoc 'b '((a 1) (b 2))) => car) (else 'none))", "b"},
+	{"(cond ((member 2 '(1 2 3))))", "(2 3)"},
+	{"(cond (#t (define x 1) (+ x 1)))", "2"},
+	{"(case (* 2 3) ((2 3 5 7) 'prime) ((1 4 6 8 9) 'composite))", "composite"},
+	{"(case 'x ((a) 1) (else 2))", "2"},
+	{"(case 'z ((a) 1))", "#f"},
+	{"(case 5 ((1) 'one) (else => (lambda (x) (* x 2))))", "10"},
+	{"(when (< 1 2) 'a 'b)", "b"},
+	{"(when (< 2 1) 'a)", "#f"},
+	{"(unless (< 2 1) 'a 'b)", "b"},
+	{"(unless (< 1 2) 'a)", "#f"},
+	{"(do ((i 0 (+ i 1)) (acc '() (cons i acc))) ((eq? i 3) acc))", "(2 1 0)"},
+	{"(define n 0) (do ((i 0 (+ i 1))) ((eq? i 4)) (set! n (+ n i))) n", "6"},
+	{"(do ((i 0 (+ i 1)) (k 'same)) ((eq? i 2) k))", "same"},
+	// begin & bodies
+	{"(begin (define x 1) (define y (+ x 1)) (list x y))", "(1 2)"},
+	{"(begin)", "#f"},
+	{"(define f (lambda (x) (define y 1) (+ x y))) (f 1)", "2"},
+	{"(let ((x 1)) (set! x (+ x 1)) x)", "2"},
+	{"(let* ((x 1)) (set! x 3) x)", "3"},
+	{"(let loop ((i 0) (acc 0)) (set! acc (+ acc i)) (if (eq? i 3) acc (loop (+ i 1) acc)))", "6"},
+	{"(define begin list) (begin 1 2)", "2"},
+	// define shorthand & internal defines
+	{"(define (add a b) (+ a b)) (add 1 2)", "3"},
+	{"(define (f) 1 2) (f)", "2"},
+	{"(define ((adder n) x) (+ n x)) ((adder 2) 3)", "5"},
+	{`(define (f n)
+	    (define (ev? n) (if (eq? n 0) #t (od? (- n 1))))
+	    (define (od? n) (if (eq? n 0) #f (ev? (- n 1))))
+	    (ev? n))
+	  (f 10)`, "#t"},
+	{"(define x 'global) (define (f) (define x 'local) x) (list (f) x)", "(local global)"},
+	{"(let () (define a 1) (define b (+ a 1)) b)", "2"},
+	// Closures capture each iteration's binding
+	{"(define fs '()) (do ((i 0 (+ i 1))) ((eq? i 2)) (set! fs (cons (lambda () i) fs))) (list ((car fs)) ((cadr-ish fs)))", "(1 0)"},
+}
+
+func TestControl(t *testing.T) {
+	for _, tc := range controlTestCases {
+		t.Run(tc.code, func(t *testing.T) {
+			interp := New()
+			run(t, interp, "(define cadr-ish (lambda (x) (car (cdr x))))")
+			out := fmt.Sprint(run(t, interp, tc.code))
+			if tc.out != out {
+				t.Fatalf("result mismatch: %s != %s", tc.out, out)
+			}
+		})
+	}
+}
+
+var paramsTestCases = []struct {
+	code string
+	out  string
+}{
+	{"((lambda args args) 1 2)", "(1 2)"},
+	{"((lambda args args))", "()"},
+	{"((lambda (a . rest) (list a rest)) 1 2 3)", "(1 (2 3))"},
+	{"(define (f a . rest) rest) (f 1)", "()"},
+	{"(define (f a #!optional (b (+ a 1)) c) (list a b c)) (list (f 1) (f 1 5) (f 1 5 6))", "((1 2 #f) (1 5 #f) (1 5 6))"},
+	{"(define (f #!optional (a 1) . r) (list a r)) (f 2 3 4)", "(2 (3 4))"},
+	{"(define (f a #:key (x 10) y) (list a x y)) (list (f 1) (f 1 #:y 3) (f 1 #:y 3 #:x 2))", "((1 10 #f) (1 10 3) (1 2 3))"},
+	{"(define (f #!optional a #:key b) (list a b)) (list (f #:b 2) (f 1 #:b 2))", "((#f 2) (1 2))"},
+	{"(define (f #:key x . r) (list x r)) (f #:x 1 #:y 2)", "(1 (#:x 1 #:y 2))"},
+	{"(keyword? #:x)", "#t"},
+	{"'(#:x y)", "(#:x y)"},
+	{"(define (f a #!optional (b 2) #:key c . r) a) f", "(lambda (a #!optional (b 2) #:key c . r) a)"},
+}
+
+func TestParams(t *testing.T) {
+	for _, tc := range paramsTestCases {
+		t.Run(tc.code, func(t *testing.T) {
+			out := fmt.Sprint(run(t, New(), tc.code))
+			if tc.out != out {
+				t.Fatalf("result mismatch: %s != %s", tc.out, out)
+			}
+		})
+	}
+}
+
+var stackTestCases = []struct {
+	code  string
+	stack []string
+}{
+	{"(car 1)", nil},
+	{`(define (check row)
+	  (car row))
+	(define (run rows)
+	  (check (car rows))
+	  'ok)
+	(run '(2))`, []string{"<test>:2:4 in check", "<test>:4:4 in run", "<test>:6:2 in <top>"}},
+	// Tail calls replace the caller frame
+	{`(define (check row) (car row))
+	(define (run row) (check row))
+	(run 2)`, []string{"<test>:1:21 in check", "<test>:3:2 in <top>"}},
+	// Procedures called from builtins
+	{`(define (f)
+	  (dynamic-wind (lambda () 1) (lambda () (car 1)) (lambda () 2)))
+	(f)`, []string{"<test>:2:43 in lambda", "<test>:2:4 in f", "<test>:3:2 in <top>"}},
+}
+
+func TestStack(t *testing.T) {
+	for _, tc := range stackTestCases {
+		t.Run(tc.code, func(t *testing.T) {
+			_, err := New().eval(strings.NewReader(tc.code), "<test>")
+			var herr *Error
+			if !errors.As(err, &herr) {
+				t.Fatalf("bad error: %v", err)
+			}
+
+			var stack []string
+			for _, f := range herr.Stack {
+				stack = append(stack, f.String())
+			}
+
+			if fmt.Sprint(stack) != fmt.Sprint(tc.stack) {
+				t.Fatalf("stack mismatch: %v != %v", tc.stack, stack)
+			}
+		})
+	}
+}
+
+var tracebackTestCases = []struct {
+	code      string
+	traceback string
+}{
+	{`(define (f n)
+	  (if (= n 0) (car n) (+ 1 (f (- n 1)))))
+	(f 3)`, `Traceback (most recent call last):
+  <test>:3:2 in <top>
+  <test>:2:29 in f
+  [previous frame repeated 2 more times]
+  <test>:2:16 in f
+<test>:2:16: car - argument 0: got 0 of type humble.Integer`},
+	// Tail call on a different line than its enclosing expression
+	{`(define (check x) (car x))
+(define (run x)
+  (if (> x 0)
+      (check x)
+      0))
+(if #t
+    (run 1))`, `Traceback (most recent call last):
+  <test>:7:5 in <top>
+  <test>:1:19 in check
+<test>:1:19: car - argument 0: got 1 of type humble.Integer`},
+	{`(define (f n)
+	  (if (= n 0) (car n) (+ 1 (f (- n 1)))))
+	(f 2000)`, `Traceback (most recent call last):
+  <test>:3:2 in <top>
+  [1002 more frames]
+  <test>:2:29 in f
+  [previous frame repeated 997 more times]
+  <test>:2:16 in f
+<test>:2:16: car - argument 0: got 0 of type humble.Integer`},
+}
+
+func TestTraceback(t *testing.T) {
+	for _, tc := range tracebackTestCases {
+		t.Run(tc.code, func(t *testing.T) {
+			_, err := New().eval(strings.NewReader(tc.code), "<test>")
+			var herr *Error
+			if !errors.As(err, &herr) {
+				t.Fatalf("bad error: %v", err)
+			}
+
+			if out := herr.Traceback(); out != tc.traceback {
+				t.Fatalf("traceback mismatch:\n%s\n!=\n%s", tc.traceback, out)
+			}
+		})
+	}
 }
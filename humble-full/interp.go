@@ -0,0 +1,89 @@
+package humble
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// Interpreter evaluates code. Every interpreter has its own global
+// environment, so definitions in one interpreter are not seen by others.
+type Interpreter struct {
+	env      *Environment
+	handlers []Callable // exception handlers stack, nil entries are guards
+}
+
+// New returns a new interpreter with a fresh global environment
+func New() *Interpreter {
+	env := NewEnvironment(nil)
+	for name, obj := range builtins.bindings {
+		env.Set(name, obj)
+	}
+
+	i := &Interpreter{env: env}
+	env.interp = i
+	for name, obj := range i.macroBuiltins() {
+		env.Set(name, obj)
+	}
+	for name, obj := range i.exceptionBuiltins() {
+		env.Set(name, obj)
+	}
+
+	return i
+}
+
+// Env returns the global environment of the interpreter
+func (i *Interpreter) Env() *Environment {
+	return i.env
+}
+
+// EvalExpr evaluates expr in the global environment
+func (i *Interpreter) EvalExpr(expr Expression) (Object, error) {
+	return expr.Eval(i.env)
+}
+
+// Eval evaluates all expressions in code, it returns the value of the last one
+func (i *Interpreter) Eval(code string) (Object, error) {
+	return i.eval(strings.NewReader(code), "<string>")
+}
+
+// EvalReader evaluates all expressions read from r, it returns the value of the
+// last one
+func (i *Interpreter) EvalReader(r io.Reader) (Object, error) {
+	name := "<input>"
+	if f, ok := r.(*os.File); ok {
+		name = f.Name()
+	}
+
+	return i.eval(r, name)
+}
+
+// Load evaluates the file at path, it returns the value of the last expression
+func (i *Interpreter) Load(path string) (Object, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return i.eval(file, path)
+}
+
+func (i *Interpreter) eval(r io.Reader, fileName string) (Object, error) {
+	rdr := NewReader(r, fileName)
+	var out Object
+	for {
+		expr, err := rdr.Read()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		out, err = i.EvalExpr(expr)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package humble
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Pair is a pair of objects, lists are chains of pairs ending with Null.
+// e.g. ("a" "b")
+type Pair struct {
+	Car Object
+	Cdr Object
+}
+
+func (p *Pair) String() string {
+	var buf bytes.Buffer
+	writeObject(&buf, p, make(map[Object]bool))
+	return buf.String()
+}
+
+// writeObject writes obj to buf. seen holds the pairs and vectors being
+// written, one that is already being written is a cycle and is written as
+// "...".
+func writeObject(buf *bytes.Buffer, obj Object, seen map[Object]bool) {
+	if v, ok := obj.(*Vector); ok {
+		writeVector(buf, v, seen)
+		return
+	}
+
+	p, ok := obj.(*Pair)
+	if !ok {
+		fmt.Fprint(buf, obj)
+		return
+	}
+
+	if seen[p] {
+		buf.WriteString("...")
+		return
+	}
+
+	buf.WriteString("(")
+	var pairs []*Pair
+	defer func() {
+		for _, p := range pairs {
+			delete(seen, p)
+		}
+	}()
+
+	for {
+		seen[p] = true
+		pairs = append(pairs, p)
+		writeObject(buf, p.Car, seen)
+
+		switch cdr := p.Cdr.(type) {
+		case *Pair:
+			buf.WriteString(" ")
+			if seen[cdr] {
+				buf.WriteString("...")
+				break
+			}
+			p = cdr
+			continue
+		case Null:
+			// end of list
+		default:
+			buf.WriteString(" . ")
+			writeObject(buf, cdr, seen)
+		}
+		break
+	}
+	buf.WriteString(")")
+}
+
+// Null is the empty list. e.g. ()
+type Null struct{}
+
+func (Null) String() string {
+	return "()"
+}
+
+func init() {
+	m := map[Symbol]Object{
+		"cons": &Function{"cons", 2, 2, func(args []Object) (Object, error) {
+			return &Pair{args[0], args[1]}, nil
+		}},
+		"car": &Function{"car", 1, 1, func(args []Object) (Object, error) {
+			p, err := pairArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return p.Car, nil
+		}},
+		"cdr": &Function{"cdr", 1, 1, func(args []Object) (Object, error) {
+			p, err := pairArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return p.Cdr, nil
+		}},
+		"set-car!": &Function{"set-car!", 2, 2, func(args []Object) (Object, error) {
+			p, err := pairArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			p.Car = args[1]
+			return p, nil
+		}},
+		"set-cdr!": &Function{"set-cdr!", 2, 2, func(args []Object) (Object, error) {
+			p, err := pairArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			p.Cdr = args[1]
+			return p, nil
+		}},
+		"list": &Function{"list", 0, -1, func(args []Object) (Object, error) {
+			return NewList(args...), nil
+		}},
+		"null?": &Function{"null?", 1, 1, func(args []Object) (Object, error) {
+			_, ok := args[0].(Null)
+			return Boolean(ok), nil
+		}},
+		"pair?": &Function{"pair?", 1, 1, func(args []Object) (Object, error) {
+			_, ok := args[0].(*Pair)
+			return Boolean(ok), nil
+		}},
+		"list?": &Function{"list?", 1, 1, func(args []Object) (Object, error) {
+			_, err := listToSlice(args[0])
+			return Boolean(err == nil), nil
+		}},
+		"symbol?": &Function{"symbol?", 1, 1, func(args []Object) (Object, error) {
+			_, ok := args[0].(Symbol)
+			return Boolean(ok), nil
+		}},
+		"length": &Function{"length", 1, 1, func(args []Object) (Object, error) {
+			items, err := listArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return Integer(len(items)), nil
+		}},
+		// (append '(1) '(2 3) '(4)), last argument is not copied
+		"append": &Function{"append", 0, -1, func(args []Object) (Object, error) {
+			if len(args) == 0 {
+				return Null{}, nil
+			}
+
+			tail := args[len(args)-1]
+			for i := len(args) - 2; i >= 0; i-- {
+				items, err := listArg(args, i)
+				if err != nil {
+					return nil, err
+				}
+				for j := len(items) - 1; j >= 0; j-- {
+					tail = &Pair{items[j], tail}
+				}
+			}
+			return tail, nil
+		}},
+		"reverse": &Function{"reverse", 1, 1, func(args []Object) (Object, error) {
+			items, err := listArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			var out Object = Null{}
+			for _, item := range items {
+				out = &Pair{item, out}
+			}
+			return out, nil
+		}},
+		"list-ref": &Function{"list-ref", 2, 2, func(args []Object) (Object, error) {
+			items, err := listArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			i, err := intArg(args, 1)
+			if err != nil {
+				return nil, err
+			}
+
+			if i < 0 || i >= len(items) {
+				return nil, fmt.Errorf("index %d out of range for list of length %d", i, len(items))
+			}
+			return items[i], nil
+		}},
+		// (assoc key alist) returns the first pair in alist whose car is equal? to key, or #f
+		"assoc": &Function{"assoc", 2, 2, func(args []Object) (Object, error) {
+			items, err := listArg(args, 1)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, item := range items {
+				p, ok := item.(*Pair)
+				if !ok {
+					return nil, fmt.Errorf("argument 1: %v is not a pair", item)
+				}
+				if isEqual(args[0], p.Car) {
+					return p, nil
+				}
+			}
+			return Boolean(false), nil
+		}},
+		// (member x list) returns the first sub list of list whose car is equal? to x, or #f
+		"member": &Function{"member", 2, 2, func(args []Object) (Object, error) {
+			obj, slow := args[1], args[1]
+			for i := 1; ; i++ {
+				p, ok := obj.(*Pair)
+				if !ok {
+					return Boolean(false), nil
+				}
+				if isEqual(args[0], p.Car) {
+					return p, nil
+				}
+				obj = p.Cdr
+
+				if i%2 == 0 {
+					slow = slow.(*Pair).Cdr
+					if slow == obj {
+						return nil, fmt.Errorf("argument 1: circular list")
+					}
+				}
+			}
+		}},
+		// (string-split s [sep]), without sep splits on whitespace
+		"string-split": &Function{"string-split", 1, 2, func(args []Object) (Object, error) {
+			s, err := stringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			var fields []string
+			if len(args) == 2 {
+				sep, err := stringArg(args, 1)
+				if err != nil {
+					return nil, err
+				}
+				fields = strings.Split(string(s), string(sep))
+			} else {
+				fields = strings.Fields(string(s))
+			}
+
+			objs := make([]Object, len(fields))
+			for i, f := range fields {
+				objs[i] = String(f)
+			}
+			return NewList(objs...), nil
+		}},
+		// (string-join list [sep]), default sep is " "
+		"string-join": &Function{"string-join", 1, 2, func(args []Object) (Object, error) {
+			items, err := listArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			sep := " "
+			if len(args) == 2 {
+				s, err := stringArg(args, 1)
+				if err != nil {
+					return nil, err
+				}
+				sep = string(s)
+			}
+
+			strs := make([]string, len(items))
+			for i := range items {
+				s, err := stringArg(items, i)
+				if err != nil {
+					return nil, fmt.Errorf("list %s", err)
+				}
+				strs[i] = string(s)
+			}
+			return String(strings.Join(strs, sep)), nil
+		}},
+		"eqv?": &Function{"eqv?", 2, 2, func(args []Object) (Object, error) {
+			return Boolean(isEqv(args[0], args[1])), nil
+		}},
+		"equal?": &Function{"equal?", 2, 2, func(args []Object) (Object, error) {
+			return Boolean(isEqual(args[0], args[1])), nil
+		}},
+	}
+
+	for name, obj := range m {
+		builtins.Set(name, obj)
+	}
+}
+
+// isEqv returns true if a and b are the same object or equal atoms
+func isEqv(a, b Object) bool {
+	if x, ok := a.(Number); ok {
+		y, ok := b.(Number)
+		return ok && numEqv(x, y)
+	}
+	return a == b
+}
+
+// isEqual returns true if a and b are structurally equal, it terminates on
+// circular lists
+func isEqual(a, b Object) bool {
+	return equalSeen(a, b, make(map[[2]Object]bool))
+}
+
+// equalSeen compares a and b. seen holds pairs of pairs already compared, they
+// are assumed equal which stops the comparison of circular lists.
+func equalSeen(a, b Object, seen map[[2]Object]bool) bool {
+	for {
+		pa, ok := a.(*Pair)
+		if !ok {
+			return isEqualAtom(a, b, seen)
+		}
+
+		pb, ok := b.(*Pair)
+		if !ok {
+			return false
+		}
+		if pa == pb {
+			return true
+		}
+
+		key := [2]Object{pa, pb}
+		if seen[key] {
+			return true
+		}
+		seen[key] = true
+
+		if !equalSeen(pa.Car, pb.Car, seen) {
+			return false
+		}
+		a, b = pa.Cdr, pb.Cdr
+	}
+}
+
+// isEqualAtom compares a and b which are not pairs, vectors are compared by
+// items and are added to seen like pairs
+func isEqualAtom(a, b Object, seen map[[2]Object]bool) bool {
+	switch a := a.(type) {
+	case *Vector:
+		b, ok := b.(*Vector)
+		if !ok || len(a.Items) != len(b.Items) {
+			return false
+		}
+		if a == b {
+			return true
+		}
+
+		key := [2]Object{a, b}
+		if seen[key] {
+			return true
+		}
+		seen[key] = true
+
+		for i, item := range a.Items {
+			if !equalSeen(item, b.Items[i], seen) {
+				return false
+			}
+		}
+		return true
+	case *Bytevector:
+		b, ok := b.(*Bytevector)
+		return ok && bytes.Equal(a.Bytes, b.Bytes)
+	}
+	return isEqv(a, b)
+}
+
+func pairArg(args []Object, i int) (*Pair, error) {
+	p, ok := args[i].(*Pair)
+	if !ok {
+		return nil, argError(args, i)
+	}
+	return p, nil
+}
+
+// listArg returns the items of argument i, which should be a list
+func listArg(args []Object, i int) ([]Object, error) {
+	items, err := listToSlice(args[i])
+	if err != nil {
+		return nil, fmt.Errorf("argument %d: %w", i, err)
+	}
+	return items, nil
+}
+
+// NewList returns a list of items
+func NewList(items ...Object) Object {
+	var list Object = Null{}
+	for i := len(items) - 1; i >= 0; i-- {
+		list = &Pair{items[i], list}
+	}
+	return list
+}
+
+// listToSlice returns the items of a proper list, circular lists are detected
+// with a slow pointer moving at half the speed
+func listToSlice(obj Object) ([]Object, error) {
+	var items []Object
+	slow := obj
+	for {
+		switch o := obj.(type) {
+		case Null:
+			return items, nil
+		case *Pair:
+			items = append(items, o.Car)
+			obj = o.Cdr
+		default:
+			return nil, fmt.Errorf("%v is not a list", obj)
+		}
+
+		if len(items)%2 == 0 {
+			slow = slow.(*Pair).Cdr
+			if slow == obj {
+				return nil, fmt.Errorf("circular list")
+			}
+		}
+	}
+}
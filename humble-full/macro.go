@@ -0,0 +1,1062 @@
+package humble
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Macro is a syntax-rules macro. e.g.
+//
+//	(define-syntax swap!
+//	  (syntax-rules ()
+//	    ((_ a b) ((lambda (tmp) (begin (set! a b) (set! b tmp))) a))))
+//
+// Macros are hygienic: symbols introduced by the macro template are renamed on
+// expansion so they won't capture user symbols, and if they are not bound by
+// the expansion they refer to the environment where the macro was defined.
+type Macro struct {
+	name     Symbol
+	env      *Environment // where the macro was defined
+	ellipsis Symbol
+	literals []Symbol
+	rules    []syntaxRule
+}
+
+type syntaxRule struct {
+	pattern  ListExpr
+	template Expression
+}
+
+func (m *Macro) String() string {
+	return fmt.Sprintf("#<macro %s>", m.name)
+}
+
+// alias is the original symbol of a symbol renamed by macro expansion
+type alias struct {
+	sym SymbolExpr
+	env *Environment // macro environment
+}
+
+// resolve returns the symbol e refers to and the environment to find it in.
+// Symbols introduced by macro expansion that are not bound in env refer to the
+// environment of the macro.
+func (e SymbolExpr) resolve(env *Environment) (SymbolExpr, *Environment) {
+	for e.alias != nil && env.Find(e.Name) == nil {
+		e, env = e.alias.sym, e.alias.env
+	}
+	return e, env
+}
+
+// macro expands a macro use to code
+type macro interface {
+	expand(form ListExpr) (Expression, error)
+}
+
+// lookupMacro returns the macro bound to name in env
+func lookupMacro(name Symbol, env *Environment) (macro, bool) {
+	env = env.Find(name)
+	if env == nil {
+		return nil, false
+	}
+
+	m, ok := env.Get(name).(macro)
+	return m, ok
+}
+
+// ProcMacro is a procedural (non hygienic) macro, it's a procedure from code to
+// code. e.g. (defmacro unless (c e) (list 'if c #f e))
+type ProcMacro struct {
+	name Symbol
+	proc Callable
+}
+
+func (m *ProcMacro) String() string {
+	return fmt.Sprintf("#<macro %s>", m.name)
+}
+
+// expand calls the macro procedure with the code of the arguments
+func (m *ProcMacro) expand(form ListExpr) (Expression, error) {
+	args, err := listToSlice(toDatum(ListExpr{Items: form.Items[1:], Tail: form.Tail}))
+	if err != nil {
+		return nil, fmt.Errorf("%s - %w", m.name, err)
+	}
+
+	out, err := m.proc.Call(args)
+	if err != nil {
+		return nil, err
+	}
+
+	expr, err := toExpr(out, form.pos)
+	if err != nil {
+		return nil, fmt.Errorf("%s - %w", m.name, err)
+	}
+	return expr, nil
+}
+
+func evalDefmacro(args []Expression, env *Environment) (Object, error) {
+	if len(args) < 3 {
+		return nil, fmt.Errorf("wrong number of arguments for 'defmacro'")
+	}
+
+	s, ok := args[0].(SymbolExpr)
+	if !ok {
+		return nil, fmt.Errorf("bad name in 'defmacro'")
+	}
+
+	proc, err := evalLambda(args[1:], env)
+	if err != nil {
+		return nil, err
+	}
+	proc.(*Lambda).name = s.Name
+
+	env.Set(s.Name, &ProcMacro{s.Name, proc.(Callable)})
+	return s.Name, nil
+}
+
+// gensymID is used to create unique symbols in gensym. Generated symbols are
+// written as prefix%id (e.g. g%12) so they read back as symbols and don't clash
+// with symbols renamed by syntax-rules (e.g. x#3).
+var gensymID atomic.Int64
+
+func init() {
+	m := map[Symbol]Object{
+		// (gensym [prefix]) returns a new unique symbol. e.g. g%12
+		"gensym": &Function{"gensym", 0, 1, func(args []Object) (Object, error) {
+			prefix := "g"
+			if len(args) == 1 {
+				switch p := args[0].(type) {
+				case String:
+					prefix = string(p)
+				case Symbol:
+					prefix = string(p)
+				default:
+					return nil, argError(args, 0)
+				}
+			}
+			return Symbol(fmt.Sprintf("%s%%%d", prefix, gensymID.Add(1))), nil
+		}},
+	}
+
+	for name, obj := range m {
+		builtins.Set(name, obj)
+	}
+}
+
+// macroBuiltins returns builtins for expanding macros defined in the
+// interpreter global environment
+func (i *Interpreter) macroBuiltins() map[Symbol]Object {
+	return map[Symbol]Object{
+		// (macroexpand-1 '(unless c e)) → (if c #f e)
+		"macroexpand-1": &Function{"macroexpand-1", 1, 1, func(args []Object) (Object, error) {
+			out, _, err := i.macroexpand1(args[0])
+			return out, err
+		}},
+		// (macroexpand form) expands form until it's not a macro use
+		"macroexpand": &Function{"macroexpand", 1, 1, func(args []Object) (Object, error) {
+			form := args[0]
+			for {
+				out, ok, err := i.macroexpand1(form)
+				if err != nil || !ok {
+					return out, err
+				}
+				form = out
+			}
+		}},
+	}
+}
+
+// macroexpand1 expands form once if it's a macro use, it returns false if it's
+// not
+func (i *Interpreter) macroexpand1(form Object) (Object, bool, error) {
+	p, ok := form.(*Pair)
+	if !ok {
+		return form, false, nil
+	}
+
+	name, ok := p.Car.(Symbol)
+	if !ok {
+		return form, false, nil
+	}
+
+	m, ok := lookupMacro(name, i.env)
+	if !ok {
+		return form, false, nil
+	}
+
+	expr, err := toExpr(form, Position{File: "<macroexpand>"})
+	if err != nil {
+		return nil, false, err
+	}
+
+	out, err := m.expand(expr.(ListExpr))
+	if err != nil {
+		return nil, false, err
+	}
+	return toDatum(out), true, nil
+}
+
+// Expand returns expr with all macro uses expanded. The output is valid source
+// code, see unrename.
+func (i *Interpreter) Expand(expr Expression) (Expression, error) {
+	out, err := expandAll(expr, i.env)
+	if err != nil {
+		return nil, err
+	}
+
+	bound := make(map[Symbol]Symbol)
+	boundRenames(out, bound)
+	return unrename(out, bound, false), nil
+}
+
+// rootSymbol returns the symbol s was renamed from by macro expansion
+func rootSymbol(s SymbolExpr) SymbolExpr {
+	for s.alias != nil {
+		s = s.alias.sym
+	}
+	return s
+}
+
+// boundRenames adds to bound the symbols renamed by syntax-rules (e.g. tmp#2)
+// that are bound in expr, with a unique name in the gensym form (e.g. tmp%7).
+func boundRenames(expr Expression, bound map[Symbol]Symbol) {
+	le, ok := expr.(ListExpr)
+	if !ok || len(le.Items) == 0 {
+		return
+	}
+
+	var names []Expression // binding positions
+	if op, ok := le.Items[0].(SymbolExpr); ok && len(le.Items) > 1 {
+		switch rootSymbol(op).Name {
+		case "quote":
+			return
+		case "lambda":
+			names = paramNames(le.Items[1])
+		case "define", "define-syntax": // (define name ...), (define ((name a) b) ...)
+			target := le.Items[1]
+			for t, ok := target.(ListExpr); ok && len(t.Items) > 0; t, ok = target.(ListExpr) {
+				names = append(names, paramNames(ListExpr{Items: t.Items[1:], Tail: t.Tail})...)
+				target = t.Items[0]
+			}
+			names = append(names, target)
+		case "let", "let*", "letrec", "letrec*", "do", "let-syntax", "letrec-syntax":
+			bindings := le.Items[1]
+			if s, ok := bindings.(SymbolExpr); ok && len(le.Items) > 2 { // named let
+				names = append(names, s)
+				bindings = le.Items[2]
+			}
+			if bl, ok := bindings.(ListExpr); ok {
+				for _, item := range bl.Items {
+					if b, ok := item.(ListExpr); ok && len(b.Items) > 0 {
+						names = append(names, b.Items[0])
+					}
+				}
+			}
+		case "guard": // (guard (var clause ...) body ...)
+			if spec, ok := le.Items[1].(ListExpr); ok && len(spec.Items) > 0 {
+				names = append(names, spec.Items[0])
+			}
+		}
+	}
+
+	for _, name := range names {
+		if s, ok := name.(SymbolExpr); ok && s.alias != nil && bound[s.Name] == "" {
+			bound[s.Name] = Symbol(fmt.Sprintf("%s%%%d", rootSymbol(s).Name, gensymID.Add(1)))
+		}
+	}
+
+	for _, item := range le.Items {
+		boundRenames(item, bound)
+	}
+	if le.Tail != nil {
+		boundRenames(le.Tail, bound)
+	}
+}
+
+// paramNames returns the names in a lambda parameters list
+func paramNames(params Expression) []Expression {
+	var names []Expression
+	for {
+		switch p := params.(type) {
+		case SymbolExpr: // (lambda args ...)
+			return append(names, p)
+		case ListExpr:
+			for _, item := range p.Items {
+				if le, ok := item.(ListExpr); ok && len(le.Items) > 0 { // (name default)
+					item = le.Items[0]
+				}
+				names = append(names, item)
+			}
+			if p.Tail != nil {
+				params = p.Tail
+				continue
+			}
+		}
+		return names
+	}
+}
+
+// unrename returns expr with symbols renamed by syntax-rules written back as
+// symbols that read back. Bound symbols get their name from bound, free symbols
+// and symbols in quoted data (datum is true) get their original name.
+func unrename(expr Expression, bound map[Symbol]Symbol, datum bool) Expression {
+	switch e := expr.(type) {
+	case SymbolExpr:
+		if e.alias == nil {
+			return e
+		}
+		if name, ok := bound[e.Name]; ok && !datum {
+			return SymbolExpr{Name: name, pos: e.pos}
+		}
+		return SymbolExpr{Name: rootSymbol(e).Name, pos: e.pos}
+	case ListExpr:
+		if len(e.Items) == 0 {
+			return e
+		}
+
+		if op, ok := e.Items[0].(SymbolExpr); ok {
+			switch rootSymbol(op).Name {
+			case "quote", "quasiquote":
+				datum = true
+			case "unquote", "unquote-splicing":
+				datum = false
+			}
+		}
+
+		out := ListExpr{Items: make([]Expression, len(e.Items)), pos: e.pos}
+		for i, item := range e.Items {
+			out.Items[i] = unrename(item, bound, datum)
+		}
+		if e.Tail != nil {
+			out.Tail = unrename(e.Tail, bound, datum)
+		}
+		return out
+	}
+	return expr
+}
+
+// expandAll expands all macro uses in expr
+func expandAll(expr Expression, env *Environment) (Expression, error) {
+	le, ok := expr.(ListExpr)
+	if !ok || len(le.Items) == 0 {
+		return expr, nil
+	}
+
+	keep := 0 // number of items to keep as is
+	if op, ok := le.Items[0].(SymbolExpr); ok {
+		sym, symEnv := op.resolve(env)
+		if m, ok := lookupMacro(sym.Name, symEnv); ok {
+			out, err := m.expand(le)
+			if err != nil {
+				return nil, withPos(err, le.pos)
+			}
+			return expandAll(out, env)
+		}
+
+		switch sym.Name {
+		case "quote", "quasiquote", "define-syntax", "defmacro":
+			return le, nil
+		case "define": // (define name ...), (define (name params ...) ...)
+			if len(le.Items) > 1 {
+				for target, ok := le.Items[1].(ListExpr); ok && len(target.Items) > 0; target, ok = target.Items[0].(ListExpr) {
+					env = shadowEnv(ListExpr{Items: target.Items[1:], Tail: target.Tail}, env)
+				}
+			}
+			keep = 2
+		case "set!": // (set! name ...)
+			keep = 2
+		case "lambda": // (lambda (params) ...)
+			if len(le.Items) > 1 {
+				env = shadowEnv(le.Items[1], env)
+			}
+			keep = 2
+		case "let", "let*", "letrec", "letrec*":
+			return expandLet(le, env, sym.Name)
+		case "cond": // (cond (test expr ...) ...)
+			return expandClauses(le, 1, 0, env)
+		case "case": // (case key ((datum ...) expr ...) ...)
+			return expandClauses(le, 2, 1, env)
+		case "do":
+			return expandDo(le, env)
+		case "guard": // (guard (var clause ...) body ...)
+			return expandGuard(le, env)
+		case "let-syntax", "letrec-syntax":
+			if len(le.Items) > 1 {
+				bodyEnv, err := letSyntaxEnv(le.Items[1], env, sym.Name == "letrec-syntax")
+				if err != nil {
+					return nil, withPos(err, le.pos)
+				}
+				env = bodyEnv
+			}
+			keep = 2
+		}
+	}
+
+	out := ListExpr{Tail: le.Tail, pos: le.pos}
+	for i, item := range le.Items {
+		if i >= keep {
+			var err error
+			if item, err = expandAll(item, env); err != nil {
+				return nil, err
+			}
+		}
+		out.Items = append(out.Items, item)
+	}
+
+	return out, nil
+}
+
+// expandLet expands macros in let forms, names bound by let shadow macros in
+// the let body.
+func expandLet(le ListExpr, env *Environment, form Symbol) (Expression, error) {
+	out := ListExpr{Items: []Expression{le.Items[0]}, Tail: le.Tail, pos: le.pos}
+	bodyEnv := NewEnvironment(env)
+	items := le.Items[1:]
+	if len(items) > 0 {
+		if s, ok := items[0].(SymbolExpr); ok { // named let
+			bodyEnv.Set(s.Name, Boolean(false))
+			out.Items = append(out.Items, s)
+			items = items[1:]
+		}
+	}
+
+	if len(items) == 0 {
+		return le, nil
+	}
+
+	bindings, ok := items[0].(ListExpr)
+	if !ok {
+		return le, nil
+	}
+
+	for _, item := range bindings.Items {
+		if b, ok := item.(ListExpr); ok && len(b.Items) > 0 {
+			if s, ok := b.Items[0].(SymbolExpr); ok {
+				bodyEnv.Set(s.Name, Boolean(false))
+			}
+		}
+	}
+
+	valueEnv := env
+	if form != "let" {
+		valueEnv = bodyEnv
+	}
+
+	expBindings := ListExpr{Tail: bindings.Tail, pos: bindings.pos}
+	for _, item := range bindings.Items {
+		b, ok := item.(ListExpr)
+		if ok && len(b.Items) == 2 {
+			val, err := expandAll(b.Items[1], valueEnv)
+			if err != nil {
+				return nil, err
+			}
+			item = ListExpr{Items: []Expression{b.Items[0], val}, pos: b.pos}
+		}
+		expBindings.Items = append(expBindings.Items, item)
+	}
+	out.Items = append(out.Items, expBindings)
+
+	for _, item := range items[1:] {
+		item, err := expandAll(item, bodyEnv)
+		if err != nil {
+			return nil, err
+		}
+		out.Items = append(out.Items, item)
+	}
+
+	return out, nil
+}
+
+// expandItems expands macros in each of items
+func expandItems(items []Expression, env *Environment) ([]Expression, error) {
+	out := make([]Expression, len(items))
+	for i, item := range items {
+		var err error
+		if out[i], err = expandAll(item, env); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// expandClauses expands macros in cond & case clauses that start at index
+// start of le, the first skip items of each clause are kept as is.
+func expandClauses(le ListExpr, start, skip int, env *Environment) (Expression, error) {
+	if len(le.Items) < start {
+		return le, nil
+	}
+
+	head, err := expandItems(le.Items[:start], env)
+	if err != nil {
+		return nil, err
+	}
+
+	out := ListExpr{Items: head, Tail: le.Tail, pos: le.pos}
+	for _, item := range le.Items[start:] {
+		if clause, ok := item.(ListExpr); ok && len(clause.Items) >= skip {
+			body, err := expandItems(clause.Items[skip:], env)
+			if err != nil {
+				return nil, err
+			}
+			items := append(append([]Expression{}, clause.Items[:skip]...), body...)
+			item = ListExpr{Items: items, Tail: clause.Tail, pos: clause.pos}
+		}
+		out.Items = append(out.Items, item)
+	}
+
+	return out, nil
+}
+
+// expandDo expands macros in (do ((var init step) ...) (test expr ...) command ...)
+func expandDo(le ListExpr, env *Environment) (Expression, error) {
+	if len(le.Items) < 3 {
+		return le, nil
+	}
+
+	specs, ok := le.Items[1].(ListExpr)
+	if !ok {
+		return le, nil
+	}
+
+	loopEnv := NewEnvironment(env)
+	for _, item := range specs.Items {
+		if spec, ok := item.(ListExpr); ok && len(spec.Items) > 0 {
+			if s, ok := spec.Items[0].(SymbolExpr); ok {
+				loopEnv.Set(s.Name, Boolean(false))
+			}
+		}
+	}
+
+	outSpecs := ListExpr{Tail: specs.Tail, pos: specs.pos}
+	for _, item := range specs.Items {
+		if spec, ok := item.(ListExpr); ok && len(spec.Items) > 1 {
+			init, err := expandAll(spec.Items[1], env)
+			if err != nil {
+				return nil, err
+			}
+
+			step, err := expandItems(spec.Items[2:], loopEnv)
+			if err != nil {
+				return nil, err
+			}
+
+			items := append([]Expression{spec.Items[0], init}, step...)
+			item = ListExpr{Items: items, Tail: spec.Tail, pos: spec.pos}
+		}
+		outSpecs.Items = append(outSpecs.Items, item)
+	}
+
+	test := le.Items[2]
+	if tl, ok := test.(ListExpr); ok { // test clause isn't a call
+		items, err := expandItems(tl.Items, loopEnv)
+		if err != nil {
+			return nil, err
+		}
+		test = ListExpr{Items: items, Tail: tl.Tail, pos: tl.pos}
+	}
+
+	body, err := expandItems(le.Items[3:], loopEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	items := append([]Expression{le.Items[0], outSpecs, test}, body...)
+	return ListExpr{Items: items, Tail: le.Tail, pos: le.pos}, nil
+}
+
+// expandGuard expands macros in (guard (var clause ...) body ...)
+func expandGuard(le ListExpr, env *Environment) (Expression, error) {
+	if len(le.Items) < 2 {
+		return le, nil
+	}
+
+	spec, ok := le.Items[1].(ListExpr)
+	if !ok || len(spec.Items) == 0 {
+		return le, nil
+	}
+
+	clauses, err := expandClauses(spec, 1, 0, shadowEnv(ListExpr{Items: spec.Items[:1]}, env))
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := expandItems(le.Items[2:], env)
+	if err != nil {
+		return nil, err
+	}
+
+	items := append([]Expression{le.Items[0], clauses}, body...)
+	return ListExpr{Items: items, Tail: le.Tail, pos: le.pos}, nil
+}
+
+// shadowEnv returns an environment where names in params are bound, so they
+// will shadow macros with the same name.
+func shadowEnv(params Expression, env *Environment) *Environment {
+	env = NewEnvironment(env)
+	for {
+		switch p := params.(type) {
+		case SymbolExpr: // (lambda args ...)
+			env.Set(p.Name, Boolean(false))
+		case ListExpr:
+			for _, item := range p.Items {
+				if le, ok := item.(ListExpr); ok && len(le.Items) > 0 { // (name default)
+					item = le.Items[0]
+				}
+				if s, ok := item.(SymbolExpr); ok {
+					env.Set(s.Name, Boolean(false))
+				}
+			}
+			if p.Tail != nil {
+				params = p.Tail
+				continue
+			}
+		}
+		return env
+	}
+}
+
+func evalDefineSyntax(args []Expression, env *Environment) (Object, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("wrong number of arguments for 'define-syntax'")
+	}
+
+	s, ok := args[0].(SymbolExpr)
+	if !ok {
+		return nil, fmt.Errorf("bad name in 'define-syntax'")
+	}
+
+	m, err := newMacro(s.Name, args[1], env)
+	if err != nil {
+		return nil, err
+	}
+
+	env.Set(s.Name, m)
+	return s.Name, nil
+}
+
+// evalLetSyntax evaluates let-syntax, and letrec-syntax if rec is true.
+// e.g. (let-syntax ((inc (syntax-rules () ((_ n) (+ n 1))))) (inc 2))
+func evalLetSyntax(args []Expression, env *Environment, rec bool) (Object, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("malformed let-syntax")
+	}
+
+	bodyEnv, err := letSyntaxEnv(args[0], env, rec)
+	if err != nil {
+		return nil, err
+	}
+
+	return evalScopeBody(args[1:], bodyEnv)
+}
+
+// letSyntaxEnv returns the environment for let-syntax body with the macros in
+// bindings.
+func letSyntaxEnv(bindingsExpr Expression, env *Environment, rec bool) (*Environment, error) {
+	bindings, ok := bindingsExpr.(ListExpr)
+	if !ok || bindings.Tail != nil {
+		return nil, fmt.Errorf("malformed let-syntax bindings")
+	}
+
+	bodyEnv := NewEnvironment(env)
+	macroEnv := env
+	if rec {
+		macroEnv = bodyEnv
+	}
+
+	for _, b := range bindings.Items {
+		le, ok := b.(ListExpr)
+		if !ok || len(le.Items) != 2 || le.Tail != nil {
+			return nil, fmt.Errorf("malformed let-syntax binding - %s", b)
+		}
+
+		s, ok := le.Items[0].(SymbolExpr)
+		if !ok {
+			return nil, fmt.Errorf("bad name in let-syntax binding - %s", b)
+		}
+
+		m, err := newMacro(s.Name, le.Items[1], macroEnv)
+		if err != nil {
+			return nil, err
+		}
+		bodyEnv.Set(s.Name, m)
+	}
+
+	return bodyEnv, nil
+}
+
+// newMacro returns a new macro from a transformer specification.
+// e.g. (syntax-rules (else) ((_ else e) e) ((_ c e) (if c e #f)))
+func newMacro(name Symbol, spec Expression, env *Environment) (*Macro, error) {
+	le, ok := spec.(ListExpr)
+	if !ok || len(le.Items) < 2 || le.Tail != nil {
+		return nil, fmt.Errorf("bad syntax transformer - %s", spec)
+	}
+
+	if op, ok := le.Items[0].(SymbolExpr); !ok || op.baseName() != "syntax-rules" {
+		return nil, fmt.Errorf("unknown syntax transformer - %s", le.Items[0])
+	}
+
+	m := &Macro{
+		name:     name,
+		env:      env,
+		ellipsis: "...",
+	}
+
+	args := le.Items[1:]
+	// (syntax-rules ::: (literals) rules ...) uses ::: as ellipsis
+	if s, ok := args[0].(SymbolExpr); ok {
+		m.ellipsis = s.baseName()
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing literals in syntax-rules")
+	}
+
+	literals, ok := args[0].(ListExpr)
+	if !ok || literals.Tail != nil {
+		return nil, fmt.Errorf("bad literals in syntax-rules - %s", args[0])
+	}
+
+	for _, lit := range literals.Items {
+		s, ok := lit.(SymbolExpr)
+		if !ok {
+			return nil, fmt.Errorf("bad literal in syntax-rules - %s", lit)
+		}
+		m.literals = append(m.literals, s.Name)
+	}
+
+	for _, r := range args[1:] {
+		rule, ok := r.(ListExpr)
+		if !ok || len(rule.Items) != 2 || rule.Tail != nil {
+			return nil, fmt.Errorf("bad syntax rule - %s", r)
+		}
+
+		pattern, ok := rule.Items[0].(ListExpr)
+		if !ok || len(pattern.Items) == 0 {
+			return nil, fmt.Errorf("bad syntax rule pattern - %s", rule.Items[0])
+		}
+
+		m.rules = append(m.rules, syntaxRule{pattern, rule.Items[1]})
+	}
+
+	return m, nil
+}
+
+// baseName returns the name of the symbol before any macro renaming
+func (e SymbolExpr) baseName() Symbol {
+	for e.alias != nil {
+		e = e.alias.sym
+	}
+	return e.Name
+}
+
+// match is the match of a pattern variable, pattern variables followed by an
+// ellipsis (seq) have a match for every repetition in items
+type match struct {
+	expr  Expression
+	seq   bool
+	items []bindings
+}
+
+// bindings of pattern variables
+type bindings map[Symbol]*match
+
+// expand expands a macro use. e.g. (swap! x y)
+func (m *Macro) expand(form ListExpr) (Expression, error) {
+	for _, rule := range m.rules {
+		b := make(bindings)
+		// First item of pattern is the macro keyword, ignore it
+		p := ListExpr{Items: rule.pattern.Items[1:], Tail: rule.pattern.Tail}
+		f := ListExpr{Items: form.Items[1:], Tail: form.Tail, pos: form.pos}
+		if !m.match(p, f, b) {
+			continue
+		}
+
+		x := &expansion{
+			macro:   m,
+			id:      expansionID.Add(1),
+			pos:     form.pos,
+			renames: make(map[Symbol]SymbolExpr),
+		}
+		return x.expand(rule.template, b)
+	}
+
+	return nil, fmt.Errorf("%s - no syntax rule matches %s", m.name, form)
+}
+
+func (m *Macro) isLiteral(name Symbol) bool {
+	for _, lit := range m.literals {
+		if lit == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Macro) isEllipsis(e Expression) bool {
+	s, ok := e.(SymbolExpr)
+	return ok && s.baseName() == m.ellipsis
+}
+
+// match matches form to pattern, filling b with pattern variables
+func (m *Macro) match(pattern, form Expression, b bindings) bool {
+	switch p := pattern.(type) {
+	case SymbolExpr:
+		if m.isLiteral(p.Name) {
+			s, ok := form.(SymbolExpr)
+			return ok && s.baseName() == p.Name
+		}
+
+		if p.Name != "_" {
+			b[p.Name] = &match{expr: form}
+		}
+		return true
+	case ListExpr:
+		f, ok := form.(ListExpr)
+		if !ok {
+			if len(p.Items) > 0 || p.Tail == nil {
+				return false
+			}
+			return m.match(p.Tail, form, b)
+		}
+		return m.matchList(p, f, b)
+	}
+
+	// Literal data. e.g. 1, "a", #t
+	return isEqual(toDatum(pattern), toDatum(form))
+}
+
+func (m *Macro) matchList(p, f ListExpr, b bindings) bool {
+	ellipsis := -1
+	for i := 1; i < len(p.Items); i++ {
+		if m.isEllipsis(p.Items[i]) {
+			ellipsis = i - 1
+			break
+		}
+	}
+
+	before, after := p.Items, []Expression(nil)
+	if ellipsis >= 0 {
+		before, after = p.Items[:ellipsis], p.Items[ellipsis+2:]
+	}
+
+	if len(f.Items) < len(before)+len(after) {
+		return false
+	}
+
+	for i, pat := range before {
+		if !m.match(pat, f.Items[i], b) {
+			return false
+		}
+	}
+
+	rest := f.Items[len(before):]
+	if ellipsis >= 0 {
+		n := len(rest) - len(after)
+		if p.Tail == nil && f.Tail != nil {
+			return false
+		}
+
+		repeated := p.Items[ellipsis]
+		var items []bindings
+		for _, form := range rest[:n] {
+			rb := make(bindings)
+			if !m.match(repeated, form, rb) {
+				return false
+			}
+			items = append(items, rb)
+		}
+
+		for _, name := range m.patternVars(repeated) {
+			b[name] = &match{seq: true, items: items}
+		}
+
+		for i, pat := range after {
+			if !m.match(pat, rest[n+i], b) {
+				return false
+			}
+		}
+		rest = nil
+	}
+
+	if p.Tail == nil {
+		return len(rest) == 0 && f.Tail == nil
+	}
+
+	// (a . rest)
+	var tail Expression = ListExpr{Items: rest, Tail: f.Tail, pos: f.pos}
+	if len(rest) == 0 && f.Tail != nil {
+		tail = f.Tail
+	}
+	return m.match(p.Tail, tail, b)
+}
+
+// patternVars returns the pattern variables in pattern
+func (m *Macro) patternVars(pattern Expression) []Symbol {
+	switch p := pattern.(type) {
+	case SymbolExpr:
+		if p.Name == "_" || m.isEllipsis(p) || m.isLiteral(p.Name) {
+			return nil
+		}
+		return []Symbol{p.Name}
+	case ListExpr:
+		var vars []Symbol
+		for _, e := range p.Items {
+			vars = append(vars, m.patternVars(e)...)
+		}
+		if p.Tail != nil {
+			vars = append(vars, m.patternVars(p.Tail)...)
+		}
+		return vars
+	}
+
+	return nil
+}
+
+// expansionID is used to create unique names for symbols introduced by macros
+var expansionID atomic.Int64
+
+// expansion is a single expansion of a macro template
+type expansion struct {
+	macro      *Macro
+	id         int64
+	pos        Position // position of macro use
+	renames    map[Symbol]SymbolExpr
+	noEllipsis bool // inside (... ...)
+}
+
+func (x *expansion) isEllipsis(e Expression) bool {
+	return !x.noEllipsis && x.macro.isEllipsis(e)
+}
+
+func (x *expansion) expand(tmpl Expression, b bindings) (Expression, error) {
+	switch t := tmpl.(type) {
+	case SymbolExpr:
+		if m, ok := b[t.Name]; ok {
+			if m.seq {
+				return nil, fmt.Errorf("%s - pattern variable %s used without ellipsis", x.macro.name, t.Name)
+			}
+			return m.expr, nil
+		}
+		return x.rename(t), nil
+	case ListExpr:
+		// (... ...) → ...
+		if len(t.Items) == 2 && t.Tail == nil && x.isEllipsis(t.Items[0]) {
+			noEllipsis := x.noEllipsis
+			x.noEllipsis = true
+			defer func() { x.noEllipsis = noEllipsis }()
+			return x.expand(t.Items[1], b)
+		}
+
+		out := ListExpr{pos: x.pos}
+		for i := 0; i < len(t.Items); i++ {
+			// x ... ... flattens one level
+			depth := 0
+			for i+depth+1 < len(t.Items) && x.isEllipsis(t.Items[i+depth+1]) {
+				depth++
+			}
+
+			if depth > 0 {
+				items, err := x.expandEllipsis(t.Items[i], b, depth)
+				if err != nil {
+					return nil, err
+				}
+				out.Items = append(out.Items, items...)
+				i += depth // skip ellipses
+				continue
+			}
+
+			e, err := x.expand(t.Items[i], b)
+			if err != nil {
+				return nil, err
+			}
+			out.Items = append(out.Items, e)
+		}
+
+		if t.Tail != nil {
+			tail, err := x.expand(t.Tail, b)
+			if err != nil {
+				return nil, err
+			}
+
+			// (a . (b c)) → (a b c)
+			if le, ok := tail.(ListExpr); ok {
+				out.Items = append(out.Items, le.Items...)
+				tail = le.Tail
+			}
+			out.Tail = tail
+		}
+		return out, nil
+	}
+
+	// Literal data. e.g. 1, "a", #t
+	return tmpl, nil
+}
+
+// expandEllipsis expands tmpl that is followed by depth ellipses
+func (x *expansion) expandEllipsis(tmpl Expression, b bindings, depth int) ([]Expression, error) {
+	var vars []Symbol
+	n := -1
+	for _, name := range x.macro.patternVars(tmpl) {
+		m, ok := b[name]
+		if !ok || !m.seq {
+			continue
+		}
+
+		if n != -1 && len(m.items) != n {
+			return nil, fmt.Errorf("%s - pattern variables under ellipsis have different lengths", x.macro.name)
+		}
+		n = len(m.items)
+		vars = append(vars, name)
+	}
+
+	if len(vars) == 0 {
+		return nil, fmt.Errorf("%s - no pattern variables before ellipsis in %s", x.macro.name, tmpl)
+	}
+
+	var out []Expression
+	for i := range n {
+		ib := make(bindings, len(b))
+		for name, m := range b {
+			ib[name] = m
+		}
+		for _, name := range vars {
+			for k, v := range b[name].items[i] {
+				ib[k] = v
+			}
+		}
+
+		if depth > 1 {
+			items, err := x.expandEllipsis(tmpl, ib, depth-1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, items...)
+			continue
+		}
+
+		e, err := x.expand(tmpl, ib)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+
+	return out, nil
+}
+
+// rename renames a symbol introduced by the macro template
+func (x *expansion) rename(s SymbolExpr) SymbolExpr {
+	if r, ok := x.renames[s.Name]; ok {
+		return r
+	}
+
+	r := SymbolExpr{
+		Name:  Symbol(fmt.Sprintf("%s#%d", s.Name, x.id)),
+		pos:   x.pos,
+		alias: &alias{s, x.macro.env},
+	}
+	x.renames[s.Name] = r
+	return r
+}
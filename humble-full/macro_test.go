@@ -0,0 +1,212 @@
+package humble
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var macroTestCases = []struct {
+	code string
+	out  string
+}{
+	// Basic
+	{`(define-syntax inc (syntax-rules () ((_ n) (+ n 1))))
+	  (inc 2)`, "3"},
+	// Several rules & recursion
+	{`(define-syntax my-or
+	    (syntax-rules ()
+	      ((_) #f)
+	      ((_ e) e)
+	      ((_ e r ...) ((lambda (t) (if t t (my-or r ...))) e))))
+	  (list (my-or) (my-or #f 2) (my-or #f #f 3))`, "(#f 2 3)"},
+	// Hygiene: t introduced by my-or does not capture user t
+	{`(define-syntax my-or
+	    (syntax-rules ()
+	      ((_ a b) ((lambda (t) (if t t b)) a))))
+	  (define t 5)
+	  (my-or #f t)`, "5"},
+	// Hygiene: tmp does not capture user tmp
+	{`(define-syntax swap!
+	    (syntax-rules ()
+	      ((_ a b) ((lambda (tmp) (begin (set! a b) (set! b tmp))) a))))
+	  (define tmp 1)
+	  (define y 2)
+	  (swap! tmp y)
+	  (list tmp y)`, "(2 1)"},
+	// Referential transparency: list in template is the global list
+	{`(define-syntax pair-of (syntax-rules () ((_ a b) (list a b))))
+	  ((lambda (list) (pair-of list 2)) 1)`, "(1 2)"},
+	// Ellipsis
+	{`(define-syntax my-let
+	    (syntax-rules ()
+	      ((_ ((name val) ...) body) ((lambda (name ...) body) val ...))))
+	  (my-let ((a 1) (b 2)) (+ a b))`, "3"},
+	// Nested ellipsis
+	{`(define-syntax flat
+	    (syntax-rules ()
+	      ((_ (a ...) ...) '(a ... ...))))
+	  (flat (1 2) () (3))`, "(1 2 3)"},
+	{`(define-syntax tables
+	    (syntax-rules ()
+	      ((_ (name v ...) ...) '((name (v ...)) ...))))
+	  (tables (a 1 2) (b))`, "((a (1 2)) (b ()))"},
+	// Items after ellipsis & dotted patterns
+	{`(define-syntax last (syntax-rules () ((_ a ... b) 'b)))
+	  (last 1 2 3)`, "3"},
+	{`(define-syntax rest (syntax-rules () ((_ a . r) 'r)))
+	  (rest 1 2 3)`, "(2 3)"},
+	// Literals
+	{`(define-syntax for
+	    (syntax-rules (in)
+	      ((_ x in lst body) (map1 (lambda (x) body) lst))))
+	  (define map1
+	    (lambda (f lst)
+	      (if (null? lst) '() (cons (f (car lst)) (map1 f (cdr lst))))))
+	  (for x in '(1 2 3) (* x x))`, "(1 4 9)"},
+	{`(define-syntax kind
+	    (syntax-rules (else)
+	      ((_ else) 'else-clause)
+	      ((_ x) 'other)))
+	  (list (kind else) (kind 1))`, "(else-clause other)"},
+	// Custom ellipsis & escaped ellipsis
+	{`(define-syntax my-list (syntax-rules ::: () ((_ x :::) (list x :::))))
+	  (my-list 1 2)`, "(1 2)"},
+	{`(define-syntax def-lister
+	    (syntax-rules ()
+	      ((_ name) (define-syntax name (syntax-rules () ((_ x (... ...)) (list x (... ...))))))))
+	  (def-lister lst)
+	  (lst 1 2 3)`, "(1 2 3)"},
+	// Literal data in patterns
+	{`(define-syntax one? (syntax-rules () ((_ 1) #t) ((_ x) #f)))
+	  (list (one? 1) (one? 2))`, "(#t #f)"},
+	// while loop
+	{`(define-syntax while
+	    (syntax-rules ()
+	      ((_ cond body ...)
+	       ((lambda (loop) (begin (set! loop (lambda () (if cond (begin body ... (loop)) #f))) (loop))) #f))))
+	  (define i 0)
+	  (define total 0)
+	  (while (< i 5) (set! total (+ total i)) (set! i (+ i 1)))
+	  total`, "10"},
+	// let-syntax scope
+	{`(define x 'outer)
+	  (let-syntax ((get-x (syntax-rules () ((_) x))))
+	    ((lambda (x) (get-x)) 'inner))`, "outer"},
+	{`(letrec-syntax ((ev? (syntax-rules () ((_) #t) ((_ x . r) (od? . r))))
+	                  (od? (syntax-rules () ((_) #f) ((_ x . r) (ev? . r)))))
+	    (ev? 1 2 3 4))`, "#t"},
+	// Quoted introduced symbols keep their name
+	{`(define-syntax sym (syntax-rules () ((_) 'hello)))
+	  (sym)`, "hello"},
+	// Quasiquote
+	{"(define x 2) `(a ,x ,@(list 3 4) . 5)", "(a 2 3 4 . 5)"},
+	{"(define x 2) `(1 `(2 ,(3 ,x)))", "(1 (quasiquote (2 (unquote (3 2)))))"},
+	{"`(1 ,@'())", "(1)"},
+	// defmacro
+	{`(defmacro my-unless (c e) (list 'if c #f e))
+	  (list (my-unless #f 1) (my-unless #t 1))`, "(1 #f)"},
+	{"(defmacro swap! (a b) ((lambda (tmp) `((lambda (,tmp) (begin (set! ,a ,b) (set! ,b ,tmp))) ,a)) (gensym)))\n" +
+		"(define x 1) (define y 2) (swap! x y) (list x y)", "(2 1)"},
+	// macroexpand
+	{`(defmacro my-unless (c e) (list 'if c #f e))
+	  (macroexpand-1 '(my-unless (< 1 2) 3))`, "(if (< 1 2) #f 3)"},
+	{`(defmacro m1 (x) (list 'm2 x))
+	  (defmacro m2 (x) (list 'quote x))
+	  (list (macroexpand-1 '(m1 a)) (macroexpand '(m1 a)) (macroexpand '(+ 1 2)))`,
+		"((m2 a) (quote a) (+ 1 2))"},
+	{`(define-syntax inc (syntax-rules () ((_ n) (+ n 1))))
+	  (macroexpand-1 '(inc 2))`, "(+ 2 1)"},
+	// gensym
+	{"(eq? (gensym) (gensym))", "#f"},
+	{"(symbol? (gensym 'tmp))", "#t"},
+}
+
+func TestMacros(t *testing.T) {
+	for _, tc := range macroTestCases {
+		t.Run(tc.code, func(t *testing.T) {
+			out := fmt.Sprint(run(t, New(), tc.code))
+			if tc.out != out {
+				t.Fatalf("result mismatch: %s != %s", tc.out, out)
+			}
+		})
+	}
+}
+
+func TestGensymReadBack(t *testing.T) {
+	for _, code := range []string{"(gensym)", "(gensym 'tmp)", `(gensym "x")`} {
+		obj := run(t, New(), code)
+		expr, err := NewReader(strings.NewReader(fmt.Sprint(obj)), "<test>").Read()
+		if err != nil {
+			t.Fatalf("%s: %s", code, err)
+		}
+
+		if sym, ok := expr.(SymbolExpr); !ok || sym.Name != obj {
+			t.Fatalf("%s: %v read back as %#v", code, obj, expr)
+		}
+	}
+}
+
+var macroErrorTestCases = []struct {
+	code string
+	err  string
+}{
+	{"(define-syntax m (syntax-rules () ((_ a) a)))\n(m 1 2)", "<test>:2:1: m - no syntax rule matches (m 1 2)"},
+	{"(define-syntax m (lambda (x) x))", "<test>:1:1: unknown syntax transformer - lambda"},
+	{"(define-syntax m (syntax-rules () ((_ a ...) a)))\n(m 1)", "<test>:2:1: m - pattern variable a used without ellipsis"},
+	{"(defmacro m (x) (car x))\n(m 1)", "<test>:1:17: car - argument 0: got 1 of type humble.Integer"},
+	{"(defmacro m)", "<test>:1:1: wrong number of arguments for 'defmacro'"},
+	{"`(1 ,@2)", "<test>:1:1: unquote-splicing - 2 is not a list"},
+}
+
+func TestMacroErrors(t *testing.T) {
+	for _, tc := range macroErrorTestCases {
+		t.Run(tc.code, func(t *testing.T) {
+			_, err := New().eval(strings.NewReader(tc.code), "<test>")
+			if err == nil {
+				t.Fatal("no error")
+			}
+
+			if err.Error() != tc.err {
+				t.Fatalf("error mismatch: %q != %q", err.Error(), tc.err)
+			}
+		})
+	}
+}
+
+var expandTestCases = []struct {
+	code string
+	out  string
+}{
+	{"(my-unless c (f x))", "(if c #f (f x))"},
+	{"(define (f) (my-unless a (my-unless b c)))", "(define (f) (if a #f (if b #f c)))"},
+	{"(define ((f my-unless) x) (my-unless x y))", "(define ((f my-unless) x) (my-unless x y))"},
+	{"'(my-unless a b)", "(quote (my-unless a b))"},
+	{"(lambda (my-unless) (my-unless a b))", "(lambda (my-unless) (my-unless a b))"},
+	{"(let ((x (my-unless a b))) (my-unless x y))", "(let ((x (if a #f b))) (if x #f y))"},
+	{"(let loop ((my-unless 1)) (my-unless a b))", "(let loop ((my-unless 1)) (my-unless a b))"},
+}
+
+func TestExpand(t *testing.T) {
+	interp := New()
+	run(t, interp, `
+	(defmacro my-unless (c e) (list 'if c #f e))`)
+
+	for _, tc := range expandTestCases {
+		t.Run(tc.code, func(t *testing.T) {
+			expr, err := NewReader(strings.NewReader(tc.code), "<test>").Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out, err := interp.Expand(expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if s := fmt.Sprint(out); s != tc.out {
+				t.Fatalf("expansion mismatch: %s != %s", tc.out, s)
+			}
+		})
+	}
+}
@@ -0,0 +1,565 @@
+package humble
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"math/cmplx"
+	"strconv"
+)
+
+// formatNumber formats n in radix, only exact numbers can use radix other
+// than 10
+func formatNumber(n Number, radix int) (string, error) {
+	if radix == 10 {
+		return n.String(), nil
+	}
+
+	switch n := n.(type) {
+	case Integer:
+		return strconv.FormatInt(int64(n), radix), nil
+	case BigInt:
+		return n.Text(radix), nil
+	case Rational:
+		return n.Num().Text(radix) + "/" + n.Denom().Text(radix), nil
+	}
+	return "", fmt.Errorf("can't format inexact number %v in radix %d", n, radix)
+}
+
+// maxBits is the maximal size in bits of exact integers created by expt and
+// arithmetic-shift
+const maxBits = 1 << 24
+
+// isNaN returns true if n is an inexact real NaN
+func isNaN(n Number) bool {
+	r, ok := n.(Real)
+	return ok && math.IsNaN(float64(r))
+}
+
+// numEqual returns true if a and b are numerically equal. e.g. (= 1 1.0)
+func numEqual(a, b Number) bool {
+	if !isReal(a) || !isReal(b) {
+		return toComplex(a) == toComplex(b)
+	}
+	return !isNaN(a) && !isNaN(b) && compare(a, b) == 0
+}
+
+// comparison returns a builtin comparing real numbers with ok on the result of
+// compare. e.g. (< 1 2 3)
+func comparison(name string, ok func(cmp int) bool) *Function {
+	return &Function{name, 2, -1, func(args []Object) (Object, error) {
+		nums := make([]Number, len(args))
+		for i := range args {
+			n, err := realArg(args, i)
+			if err != nil {
+				return nil, err
+			}
+			nums[i] = n
+		}
+
+		for i := 1; i < len(nums); i++ {
+			a, b := nums[i-1], nums[i]
+			if isNaN(a) || isNaN(b) || !ok(compare(a, b)) {
+				return Boolean(false), nil
+			}
+		}
+		return Boolean(true), nil
+	}}
+}
+
+// integerArg returns argument i, which must be an integer (exact or inexact)
+func integerArg(args []Object, i int) (Number, error) {
+	n, ok := args[i].(Number)
+	if !ok {
+		return nil, argError(args, i)
+	}
+
+	if !isInteger(n) {
+		return nil, fmt.Errorf("argument %d: %v is not an integer", i, n)
+	}
+	return n, nil
+}
+
+// exactIntArg returns argument i as big.Int, it must be an exact integer
+func exactIntArg(args []Object, i int) (*big.Int, error) {
+	n, ok := args[i].(Number)
+	if !ok {
+		return nil, argError(args, i)
+	}
+
+	switch n.(type) {
+	case Integer, BigInt:
+		return toBig(n), nil
+	}
+	return nil, fmt.Errorf("argument %d: %v is not an exact integer", i, n)
+}
+
+// integerDivision returns a builtin dividing two integers with exact and
+// inexact implementations of the operation
+func integerDivision(name string, exact func(a, b *big.Int) *big.Int, inexact func(a, b float64) float64) *Function {
+	return &Function{name, 2, 2, func(args []Object) (Object, error) {
+		a, err := integerArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		b, err := integerArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		if !a.IsExact() || !b.IsExact() {
+			return Real(inexact(toFloat(a), toFloat(b))), nil
+		}
+
+		if isZero(b) {
+			return nil, errDivByZero
+		}
+		return normBig(exact(toBig(a), toBig(b))), nil
+	}}
+}
+
+// floorMod returns a modulo b with the sign of b
+func floorMod(a, b *big.Int) *big.Int {
+	r := new(big.Int).Rem(a, b)
+	if r.Sign() != 0 && r.Sign() != b.Sign() {
+		r.Add(r, b)
+	}
+	return r
+}
+
+// gcd returns the greatest common divisor of a and b, always non negative
+func gcd(a, b *big.Int) *big.Int {
+	return new(big.Int).GCD(nil, nil, new(big.Int).Abs(a), new(big.Int).Abs(b))
+}
+
+// gcdFold returns a builtin folding integer arguments with op, starting with
+// zero. Used for gcd & lcm.
+func gcdFold(name string, zero int64, op func(a, b *big.Int) *big.Int) *Function {
+	return &Function{name, 0, -1, func(args []Object) (Object, error) {
+		total, exact := big.NewInt(zero), true
+		for i := range args {
+			n, err := integerArg(args, i)
+			if err != nil {
+				return nil, err
+			}
+
+			e, err := toExact(n)
+			if err != nil {
+				return nil, err
+			}
+			exact = exact && n.IsExact()
+			total = op(total, toBig(e))
+		}
+
+		if !exact {
+			return toInexact(normBig(total)), nil
+		}
+		return normBig(total), nil
+	}}
+}
+
+// rounding returns a builtin rounding real numbers. Exact numbers stay exact.
+func rounding(name string, exact func(num, denom *big.Int) *big.Int, inexact func(float64) float64) *Function {
+	return &Function{name, 1, 1, func(args []Object) (Object, error) {
+		n, err := realArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		switch n := n.(type) {
+		case Integer, BigInt:
+			return n, nil
+		case Rational:
+			return normBig(exact(n.Num(), n.Denom())), nil
+		}
+		return Real(inexact(toFloat(n))), nil
+	}}
+}
+
+// floorDiv returns num/denom rounded toward negative infinity, denom > 0
+func floorDiv(num, denom *big.Int) *big.Int {
+	q, _ := new(big.Int).DivMod(num, denom, new(big.Int))
+	return q
+}
+
+// roundDiv returns num/denom rounded to the nearest integer, ties to even
+func roundDiv(num, denom *big.Int) *big.Int {
+	q, m := new(big.Int).DivMod(num, denom, new(big.Int))
+	switch m.Lsh(m, 1).Cmp(denom) { // compare remainder to denom/2
+	case 1:
+		q.Add(q, big.NewInt(1))
+	case 0:
+		if q.Bit(0) == 1 {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+// exactSqrt returns the square root of n if it's an exact non negative
+// integer with an exact integer root
+func exactSqrt(n *big.Int) (*big.Int, bool) {
+	if n.Sign() < 0 {
+		return nil, false
+	}
+
+	s := new(big.Int).Sqrt(n)
+	return s, new(big.Int).Mul(s, s).Cmp(n) == 0
+}
+
+// sqrt returns the square root of n, exact for exact squares. e.g. (sqrt 1/4) → 1/2
+func sqrt(n Number) Number {
+	switch n.(type) {
+	case Integer, BigInt, Rational:
+		r := new(big.Rat).Abs(toRat(n))
+		num, ok1 := exactSqrt(r.Num())
+		denom, ok2 := exactSqrt(r.Denom())
+		if ok1 && ok2 {
+			s := normRat(new(big.Rat).SetFrac(num, denom))
+			if compare(n, Integer(0)) < 0 {
+				return normComplex(complex(0, toFloat(s)))
+			}
+			return s
+		}
+	case Complex:
+		return normComplex(cmplx.Sqrt(toComplex(n)))
+	}
+
+	f := toFloat(n)
+	if f < 0 {
+		return normComplex(complex(0, math.Sqrt(-f)))
+	}
+	return Real(math.Sqrt(f))
+}
+
+// expt returns base raised to the power of exp, exact if base is exact and
+// exp is an exact integer
+func expt(base, exp Number) (Number, error) {
+	if e, ok := exp.(Integer); ok && base.IsExact() {
+		if e < 0 && isZero(base) {
+			return nil, errDivByZero
+		}
+
+		r := toRat(base)
+		pow := big.NewInt(int64(e))
+		pow.Abs(pow)
+		for _, n := range []*big.Int{r.Num(), r.Denom()} {
+			if bits := n.BitLen() - 1; bits > 0 && pow.Cmp(big.NewInt(maxBits/int64(bits))) > 0 {
+				return nil, fmt.Errorf("exponent %d is too large", e)
+			}
+		}
+		num := new(big.Int).Exp(r.Num(), pow, nil)
+		denom := new(big.Int).Exp(r.Denom(), pow, nil)
+		if e < 0 {
+			num, denom = denom, num
+		}
+		return normRat(new(big.Rat).SetFrac(num, denom)), nil
+	}
+
+	if !isReal(base) || !isReal(exp) || (compare(base, Integer(0)) < 0 && !isInteger(exp)) {
+		return normComplex(cmplx.Pow(toComplex(base), toComplex(exp))), nil
+	}
+	return Real(math.Pow(toFloat(base), toFloat(exp))), nil
+}
+
+// transcendental returns a builtin for a math function with real and complex
+// implementations. Real arguments outside of inDomain use the complex
+// implementation. e.g. (asin 2)
+func transcendental(name string, realOp func(float64) float64, complexOp func(complex128) complex128, inDomain func(float64) bool) *Function {
+	return &Function{name, 1, 1, numeric(func(args []Number) (Object, error) {
+		n := args[0]
+		if isReal(n) && (inDomain == nil || inDomain(toFloat(n))) {
+			return Real(realOp(toFloat(n))), nil
+		}
+		return normComplex(complexOp(toComplex(n))), nil
+	})}
+}
+
+// bitwiseFold returns a builtin folding exact integer arguments with op
+func bitwiseFold(name string, zero int64, op func(z, a, b *big.Int) *big.Int) *Function {
+	return &Function{name, 0, -1, func(args []Object) (Object, error) {
+		total := big.NewInt(zero)
+		for i := range args {
+			n, err := exactIntArg(args, i)
+			if err != nil {
+				return nil, err
+			}
+			total = op(new(big.Int), total, n)
+		}
+		return normBig(total), nil
+	}}
+}
+
+func init() {
+	m := map[Symbol]Object{
+		"<":  comparison("<", func(cmp int) bool { return cmp < 0 }),
+		"<=": comparison("<=", func(cmp int) bool { return cmp <= 0 }),
+		">":  comparison(">", func(cmp int) bool { return cmp > 0 }),
+		">=": comparison(">=", func(cmp int) bool { return cmp >= 0 }),
+		"=": &Function{"=", 2, -1, numeric(func(args []Number) (Object, error) {
+			for i := 1; i < len(args); i++ {
+				if !numEqual(args[i-1], args[i]) {
+					return Boolean(false), nil
+				}
+			}
+			return Boolean(true), nil
+		})},
+		"zero?": &Function{"zero?", 1, 1, numeric(func(args []Number) (Object, error) {
+			return Boolean(isZero(args[0])), nil
+		})},
+		"positive?": &Function{"positive?", 1, 1, func(args []Object) (Object, error) {
+			n, err := realArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return Boolean(!isNaN(n) && compare(n, Integer(0)) > 0), nil
+		}},
+		"negative?": &Function{"negative?", 1, 1, func(args []Object) (Object, error) {
+			n, err := realArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return Boolean(!isNaN(n) && compare(n, Integer(0)) < 0), nil
+		}},
+		"odd?": &Function{"odd?", 1, 1, func(args []Object) (Object, error) {
+			n, err := integerArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			r, err := remainder(n, Integer(2))
+			if err != nil {
+				return nil, err
+			}
+			return Boolean(!isZero(r)), nil
+		}},
+		"even?": &Function{"even?", 1, 1, func(args []Object) (Object, error) {
+			n, err := integerArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			r, err := remainder(n, Integer(2))
+			if err != nil {
+				return nil, err
+			}
+			return Boolean(isZero(r)), nil
+		}},
+		"exact-integer?": &Function{"exact-integer?", 1, 1, func(args []Object) (Object, error) {
+			switch args[0].(type) {
+			case Integer, BigInt:
+				return Boolean(true), nil
+			}
+			return Boolean(false), nil
+		}},
+		// Exact numbers are finite, they are not converted since they can
+		// overflow a float. e.g. (expt 10 400)
+		"nan?": &Function{"nan?", 1, 1, numeric(func(args []Number) (Object, error) {
+			if args[0].IsExact() {
+				return Boolean(false), nil
+			}
+			c := toComplex(args[0])
+			return Boolean(math.IsNaN(real(c)) || math.IsNaN(imag(c))), nil
+		})},
+		"infinite?": &Function{"infinite?", 1, 1, numeric(func(args []Number) (Object, error) {
+			if args[0].IsExact() {
+				return Boolean(false), nil
+			}
+			c := toComplex(args[0])
+			return Boolean(math.IsInf(real(c), 0) || math.IsInf(imag(c), 0)), nil
+		})},
+		"finite?": &Function{"finite?", 1, 1, numeric(func(args []Number) (Object, error) {
+			if args[0].IsExact() {
+				return Boolean(true), nil
+			}
+			return Boolean(!cmplx.IsInf(toComplex(args[0])) && !cmplx.IsNaN(toComplex(args[0]))), nil
+		})},
+		"abs": &Function{"abs", 1, 1, func(args []Object) (Object, error) {
+			n, err := realArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			if r, ok := n.(Real); ok {
+				return Real(math.Abs(float64(r))), nil
+			}
+			if compare(n, Integer(0)) < 0 {
+				return sub(Integer(0), n), nil
+			}
+			return n, nil
+		}},
+		"min": &Function{"min", 1, -1, func(args []Object) (Object, error) {
+			return extreme(args, -1)
+		}},
+		"max": &Function{"max", 1, -1, func(args []Object) (Object, error) {
+			return extreme(args, 1)
+		}},
+		"square": &Function{"square", 1, 1, numeric(func(args []Number) (Object, error) {
+			return mul(args[0], args[0]), nil
+		})},
+		"quotient": integerDivision("quotient", func(a, b *big.Int) *big.Int {
+			return new(big.Int).Quo(a, b)
+		}, func(a, b float64) float64 {
+			return math.Trunc(a / b)
+		}),
+		"remainder": integerDivision("remainder", func(a, b *big.Int) *big.Int {
+			return new(big.Int).Rem(a, b)
+		}, math.Mod),
+		"modulo": integerDivision("modulo", floorMod, func(a, b float64) float64 {
+			m := math.Mod(a, b)
+			if m != 0 && (m < 0) != (b < 0) {
+				m += b
+			}
+			return m
+		}),
+		"gcd": gcdFold("gcd", 0, gcd),
+		"lcm": gcdFold("lcm", 1, func(a, b *big.Int) *big.Int {
+			if a.Sign() == 0 || b.Sign() == 0 {
+				return new(big.Int)
+			}
+			l := new(big.Int).Mul(a, b)
+			return l.Abs(l.Quo(l, gcd(a, b)))
+		}),
+		"floor": rounding("floor", floorDiv, math.Floor),
+		"ceiling": rounding("ceiling", func(num, denom *big.Int) *big.Int {
+			q := floorDiv(new(big.Int).Neg(num), denom)
+			return q.Neg(q)
+		}, math.Ceil),
+		"truncate": rounding("truncate", func(num, denom *big.Int) *big.Int {
+			return new(big.Int).Quo(num, denom)
+		}, math.Trunc),
+		"round": rounding("round", roundDiv, math.RoundToEven),
+		"sqrt": &Function{"sqrt", 1, 1, numeric(func(args []Number) (Object, error) {
+			return sqrt(args[0]), nil
+		})},
+		// (exact-integer-sqrt 17) → (4 1), the root and the remainder
+		"exact-integer-sqrt": &Function{"exact-integer-sqrt", 1, 1, func(args []Object) (Object, error) {
+			n, err := exactIntArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			if n.Sign() < 0 {
+				return nil, fmt.Errorf("argument 0: %v is negative", n)
+			}
+
+			s := new(big.Int).Sqrt(n)
+			r := new(big.Int).Sub(n, new(big.Int).Mul(s, s))
+			return NewList(normBig(s), normBig(r)), nil
+		}},
+		"expt": &Function{"expt", 2, 2, numeric(func(args []Number) (Object, error) {
+			return expt(args[0], args[1])
+		})},
+		"exp": transcendental("exp", math.Exp, cmplx.Exp, nil),
+		// (log z) is the natural logarithm, (log z b) is the logarithm in base b
+		"log": &Function{"log", 1, 2, numeric(func(args []Number) (Object, error) {
+			n := logarithm(args[0])
+			if len(args) == 1 {
+				return n, nil
+			}
+			return div(n, logarithm(args[1]))
+		})},
+		"sin":  transcendental("sin", math.Sin, cmplx.Sin, nil),
+		"cos":  transcendental("cos", math.Cos, cmplx.Cos, nil),
+		"tan":  transcendental("tan", math.Tan, cmplx.Tan, nil),
+		"asin": transcendental("asin", math.Asin, cmplx.Asin, inUnitRange),
+		"acos": transcendental("acos", math.Acos, cmplx.Acos, inUnitRange),
+		// (atan z), (atan y x)
+		"atan": &Function{"atan", 1, 2, numeric(func(args []Number) (Object, error) {
+			if len(args) == 1 {
+				if !isReal(args[0]) {
+					return normComplex(cmplx.Atan(toComplex(args[0]))), nil
+				}
+				return Real(math.Atan(toFloat(args[0]))), nil
+			}
+
+			if !isReal(args[0]) || !isReal(args[1]) {
+				return nil, fmt.Errorf("atan with two arguments needs real numbers")
+			}
+			return Real(math.Atan2(toFloat(args[0]), toFloat(args[1]))), nil
+		})},
+		"bitwise-and": bitwiseFold("bitwise-and", -1, (*big.Int).And),
+		"bitwise-or":  bitwiseFold("bitwise-or", 0, (*big.Int).Or),
+		"bitwise-xor": bitwiseFold("bitwise-xor", 0, (*big.Int).Xor),
+		"bitwise-not": &Function{"bitwise-not", 1, 1, func(args []Object) (Object, error) {
+			n, err := exactIntArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return normBig(new(big.Int).Not(n)), nil
+		}},
+		// (arithmetic-shift 1 3) → 8, (arithmetic-shift 8 -3) → 1
+		"arithmetic-shift": &Function{"arithmetic-shift", 2, 2, func(args []Object) (Object, error) {
+			n, err := exactIntArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			count, err := intArg(args, 1)
+			if err != nil {
+				return nil, err
+			}
+
+			if count > maxBits {
+				return nil, fmt.Errorf("argument 1: shift count %d is too large", count)
+			}
+			if count < 0 {
+				return normBig(new(big.Int).Rsh(n, uint(-count))), nil
+			}
+			return normBig(new(big.Int).Lsh(n, uint(count))), nil
+		}},
+		// (bit-count 7) → 3, negative numbers count the 0 bits
+		"bit-count": &Function{"bit-count", 1, 1, func(args []Object) (Object, error) {
+			n, err := exactIntArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			if n.Sign() < 0 {
+				n = new(big.Int).Not(n)
+			}
+			count := 0
+			for _, w := range n.Bits() {
+				count += bits.OnesCount(uint(w))
+			}
+			return Integer(count), nil
+		}},
+	}
+
+	for name, obj := range m {
+		builtins.Set(name, obj)
+	}
+}
+
+// extreme returns the minimal (sign -1) or maximal (sign 1) argument, the
+// result is inexact if any argument is inexact
+func extreme(args []Object, sign int) (Object, error) {
+	var result Number
+	exact := true
+	for i := range args {
+		n, err := realArg(args, i)
+		if err != nil {
+			return nil, err
+		}
+
+		exact = exact && n.IsExact()
+		if result == nil || isNaN(n) || (!isNaN(result) && compare(n, result) == sign) {
+			result = n
+		}
+	}
+
+	if !exact {
+		return toInexact(result), nil
+	}
+	return result, nil
+}
+
+// logarithm returns the natural logarithm of n, negative and complex numbers
+// have complex logarithms
+func logarithm(n Number) Number {
+	if isReal(n) && compare(n, Integer(0)) >= 0 {
+		return Real(math.Log(toFloat(n)))
+	}
+	return normComplex(cmplx.Log(toComplex(n)))
+}
+
+func inUnitRange(f float64) bool {
+	return f >= -1 && f <= 1
+}
@@ -0,0 +1,131 @@
+package humble
+
+import (
+	"fmt"
+	"testing"
+)
+
+var mathTestCases = []struct {
+	code string
+	out  string
+}{
+	{"(- 5)", "-5"},
+	{"(- 10 1 2)", "7"},
+	{"(/ 2)", "1/2"},
+	{"(/ 12 2 3)", "2"},
+	{"(< 1 2 3)", "#t"},
+	{"(< 1 3 2)", "#f"},
+	{"(<= 1 1 2)", "#t"},
+	{"(> 3 2 1)", "#t"},
+	{"(>= 3 2 2)", "#t"},
+	{"(= 1 1.0 1)", "#t"},
+	{"(= 1+i 1+i)", "#t"},
+	{"(= +nan.0 +nan.0)", "#f"},
+	{"(= (+ (expt 2 70) 1) (expt 2. 70))", "#f"},
+	{"(< (expt 2 70) (+ (expt 2 70) 1) (+ (expt 2. 70) 1e6))", "#t"},
+	{"(= 1/3 (/ 1. 3))", "#f"},
+	{"(< (expt 10 400) +inf.0)", "#t"},
+	{"(> (expt 10 400) 1e308 -inf.0)", "#t"},
+	{"(zero? 0.0)", "#t"},
+	{"(positive? 1/2)", "#t"},
+	{"(negative? -1)", "#t"},
+	{"(odd? 3)", "#t"},
+	{"(even? 2.0)", "#t"},
+	{"(exact-integer? 2.0)", "#f"},
+	{"(nan? +nan.0)", "#t"},
+	{"(infinite? -inf.0)", "#t"},
+	{"(infinite? (expt 10 400))", "#f"},
+	{"(finite? (expt 10 400))", "#t"},
+	{"(nan? (/ (expt 10 400) 3))", "#f"},
+	{"(finite? 1/2)", "#t"},
+	{"(abs -7/2)", "7/2"},
+	{"(abs -2.5)", "2.5"},
+	{"(min 1 2.0)", "1.0"},
+	{"(max 1 3 2)", "3"},
+	{"(min 1 +nan.0)", "+nan.0"},
+	{"(square 1/2)", "1/4"},
+	{"(quotient -7 2)", "-3"},
+	{"(remainder -7 2)", "-1"},
+	{"(modulo -7 2)", "1"},
+	{"(modulo 7 -2)", "-1"},
+	{"(modulo -7.0 2)", "1.0"},
+	{"(gcd 12 18)", "6"},
+	{"(gcd)", "0"},
+	{"(lcm 4 6)", "12"},
+	{"(lcm 4.0 6)", "12.0"},
+	{"(lcm)", "1"},
+	{"(floor -7/2)", "-4"},
+	{"(ceiling -7/2)", "-3"},
+	{"(truncate -7/2)", "-3"},
+	{"(round 7/2)", "4"},
+	{"(round 5/2)", "2"},
+	{"(round -5/2)", "-2"},
+	{"(round 2.5)", "2.0"},
+	{"(floor -2.5)", "-3.0"},
+	{"(truncate -2.7)", "-2.0"},
+	{"(sqrt 16)", "4"},
+	{"(sqrt 1/4)", "1/2"},
+	{"(sqrt 2)", "1.4142135623730951"},
+	{"(sqrt -4)", "0.0+2.0i"},
+	{"(sqrt -4.0)", "0.0+2.0i"},
+	{"(exact-integer-sqrt 17)", "(4 1)"},
+	{"(expt 2 100)", "1267650600228229401496703205376"},
+	{"(expt 2 -2)", "1/4"},
+	{"(expt 2/3 2)", "4/9"},
+	{"(expt 2.0 3)", "8.0"},
+	{"(expt 1 100000000000000)", "1"},
+	{"(exp 0)", "1.0"},
+	{"(log 1)", "0.0"},
+	{"(log 100 10)", "2.0"},
+	{"(log -1)", "0.0+3.141592653589793i"},
+	{"(sin 0)", "0.0"},
+	{"(cos 0)", "1.0"},
+	{"(tan 0)", "0.0"},
+	{"(asin 1)", "1.5707963267948966"},
+	{"(acos 1)", "0.0"},
+	{"(atan 1 1)", "0.7853981633974483"},
+	{"(number->string 255 16)", `"ff"`},
+	{"(number->string -10 2)", `"-1010"`},
+	{"(number->string 1/3 2)", `"1/11"`},
+	{"(bitwise-and 12 10)", "8"},
+	{"(bitwise-or 12 10)", "14"},
+	{"(bitwise-xor 12 10)", "6"},
+	{"(bitwise-not 0)", "-1"},
+	{"(arithmetic-shift 1 100)", "1267650600228229401496703205376"},
+	{"(arithmetic-shift -8 -1)", "-4"},
+	{"(arithmetic-shift 1 -100000000000000)", "0"},
+	{"(bit-count 7)", "3"},
+}
+
+func TestMath(t *testing.T) {
+	for _, tc := range mathTestCases {
+		t.Run(tc.code, func(t *testing.T) {
+			out := fmt.Sprint(run(t, New(), tc.code))
+			if tc.out != out {
+				t.Fatalf("result mismatch: %s != %s", tc.out, out)
+			}
+		})
+	}
+}
+
+var mathErrorTestCases = []errorTestCase{
+	{"(/ 1 2 0)", "<test>:1:1: / - division by zero"},
+	{"(< 1 'a)", "<test>:1:1: < - argument 1: got a of type humble.Symbol"},
+	{"(< 1)", "<test>:1:1: < - wrong number of arguments (want at least 2, got 1)"},
+	{"(= 1)", "<test>:1:1: = - wrong number of arguments (want at least 2, got 1)"},
+	{"(odd? 1.5)", "<test>:1:1: odd? - argument 0: 1.5 is not an integer"},
+	{"(quotient 1 0)", "<test>:1:1: quotient - division by zero"},
+	{"(quotient 1.5 1)", "<test>:1:1: quotient - argument 0: 1.5 is not an integer"},
+	{"(exact-integer-sqrt -1)", "<test>:1:1: exact-integer-sqrt - argument 0: -1 is negative"},
+	{"(expt 0 -1)", "<test>:1:1: expt - division by zero"},
+	{"(expt 2 100000000000000)", "<test>:1:1: expt - exponent 100000000000000 is too large"},
+	{"(expt 1/3 -100000000000000)", "<test>:1:1: expt - exponent -100000000000000 is too large"},
+	{"(number->string 1.5 2)", "<test>:1:1: number->string - can't format inexact number 1.5 in radix 2"},
+	{"(number->string 1 7)", "<test>:1:1: number->string - argument 1: bad radix - 7"},
+	{"(arithmetic-shift 1 100000000000000)", "<test>:1:1: arithmetic-shift - argument 1: shift count 100000000000000 is too large"},
+	{"(bitwise-and 1.0 1)", "<test>:1:1: bitwise-and - argument 0: 1.0 is not an exact integer"},
+}
+
+func TestMathErrors(t *testing.T) {
+	testErrors(t, mathErrorTestCases)
+}
@@ -0,0 +1,650 @@
+package humble
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/cmplx"
+	"strconv"
+)
+
+// Number is a number in the language. Exact numbers are Integer, BigInt and
+// Rational, inexact numbers are Real and Complex.
+type Number interface {
+	fmt.Stringer
+	// IsExact returns true for exact numbers
+	IsExact() bool
+}
+
+// Integer is an exact integer
+type Integer int64
+
+func (n Integer) String() string {
+	return strconv.FormatInt(int64(n), 10)
+}
+
+// IsExact implements Number
+func (n Integer) IsExact() bool {
+	return true
+}
+
+// BigInt is an exact integer that doesn't fit in an Integer. Operations on
+// integers overflowing int64 return a BigInt, and results that fit in int64
+// return an Integer.
+type BigInt struct {
+	*big.Int
+}
+
+// IsExact implements Number
+func (n BigInt) IsExact() bool {
+	return true
+}
+
+// Rational is an exact fraction. e.g. 1/3
+// Rationals with denominator 1 are converted to integers.
+type Rational struct {
+	*big.Rat
+}
+
+func (n Rational) String() string {
+	return n.RatString()
+}
+
+// IsExact implements Number
+func (n Rational) IsExact() bool {
+	return true
+}
+
+// Real is an inexact real number
+type Real float64
+
+func (n Real) String() string {
+	return formatReal(float64(n))
+}
+
+// IsExact implements Number
+func (n Real) IsExact() bool {
+	return false
+}
+
+// Complex is an inexact complex number. e.g. 1.0+2.0i
+// Complex numbers with zero imaginary part are converted to Real.
+type Complex complex128
+
+func (n Complex) String() string {
+	im := formatReal(imag(complex128(n)))
+	if im[0] != '-' && im[0] != '+' {
+		im = "+" + im
+	}
+	return formatReal(real(complex128(n))) + im + "i"
+}
+
+// IsExact implements Number
+func (n Complex) IsExact() bool {
+	return false
+}
+
+// formatReal formats f, integral values are printed with a trailing .0 to mark
+// them as inexact
+func formatReal(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+inf.0"
+	case math.IsInf(f, -1):
+		return "-inf.0"
+	case math.IsNaN(f):
+		return "+nan.0"
+	}
+
+	if f == math.Trunc(f) && math.Abs(f) < 1e21 {
+		return strconv.FormatFloat(f, 'f', 1, 64)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Levels in the numeric tower, operations convert both arguments to the higher
+// level
+const (
+	integerLevel = iota
+	bigLevel
+	rationalLevel
+	realLevel
+	complexLevel
+)
+
+func level(n Number) int {
+	switch n.(type) {
+	case Integer:
+		return integerLevel
+	case BigInt:
+		return bigLevel
+	case Rational:
+		return rationalLevel
+	case Real:
+		return realLevel
+	}
+	return complexLevel
+}
+
+// toBig converts an exact integer to big.Int
+func toBig(n Number) *big.Int {
+	switch n := n.(type) {
+	case Integer:
+		return big.NewInt(int64(n))
+	case BigInt:
+		return n.Int
+	}
+	panic(fmt.Sprintf("%v (%T) is not an exact integer", n, n))
+}
+
+// toRat converts an exact number to big.Rat
+func toRat(n Number) *big.Rat {
+	if r, ok := n.(Rational); ok {
+		return r.Rat
+	}
+	return new(big.Rat).SetInt(toBig(n))
+}
+
+// toFloat converts a real number to float64
+func toFloat(n Number) float64 {
+	switch n := n.(type) {
+	case Integer:
+		return float64(n)
+	case BigInt:
+		f, _ := new(big.Float).SetInt(n.Int).Float64()
+		return f
+	case Rational:
+		f, _ := n.Float64()
+		return f
+	case Real:
+		return float64(n)
+	}
+	panic(fmt.Sprintf("%v (%T) is not a real number", n, n))
+}
+
+// toComplex converts n to complex128
+func toComplex(n Number) complex128 {
+	if c, ok := n.(Complex); ok {
+		return complex128(c)
+	}
+	return complex(toFloat(n), 0)
+}
+
+// normBig returns n as Integer if it fits in int64
+func normBig(n *big.Int) Number {
+	if n.IsInt64() {
+		return Integer(n.Int64())
+	}
+	return BigInt{n}
+}
+
+// normRat returns n as an integer if its denominator is 1
+func normRat(n *big.Rat) Number {
+	if n.IsInt() {
+		return normBig(new(big.Int).Set(n.Num()))
+	}
+	return Rational{n}
+}
+
+// normComplex returns c as Real if its imaginary part is 0
+func normComplex(c complex128) Number {
+	if imag(c) == 0 {
+		return Real(real(c))
+	}
+	return Complex(c)
+}
+
+func add(a, b Number) Number {
+	switch max(level(a), level(b)) {
+	case integerLevel:
+		x, y := a.(Integer), b.(Integer)
+		if s := x + y; (s > x) == (y > 0) {
+			return s
+		}
+		return normBig(new(big.Int).Add(toBig(a), toBig(b)))
+	case bigLevel:
+		return normBig(new(big.Int).Add(toBig(a), toBig(b)))
+	case rationalLevel:
+		return normRat(new(big.Rat).Add(toRat(a), toRat(b)))
+	case realLevel:
+		return Real(toFloat(a) + toFloat(b))
+	}
+	return normComplex(toComplex(a) + toComplex(b))
+}
+
+func sub(a, b Number) Number {
+	switch max(level(a), level(b)) {
+	case integerLevel:
+		x, y := a.(Integer), b.(Integer)
+		if s := x - y; (s < x) == (y > 0) {
+			return s
+		}
+		return normBig(new(big.Int).Sub(toBig(a), toBig(b)))
+	case bigLevel:
+		return normBig(new(big.Int).Sub(toBig(a), toBig(b)))
+	case rationalLevel:
+		return normRat(new(big.Rat).Sub(toRat(a), toRat(b)))
+	case realLevel:
+		return Real(toFloat(a) - toFloat(b))
+	}
+	return normComplex(toComplex(a) - toComplex(b))
+}
+
+func mul(a, b Number) Number {
+	switch max(level(a), level(b)) {
+	case integerLevel:
+		x, y := a.(Integer), b.(Integer)
+		if x == 0 || y == 0 {
+			return Integer(0)
+		}
+		p := x * y
+		if p/y == x && p/x == y && !(x == -1 && y == math.MinInt64) && !(y == -1 && x == math.MinInt64) {
+			return p
+		}
+		return normBig(new(big.Int).Mul(toBig(a), toBig(b)))
+	case bigLevel:
+		return normBig(new(big.Int).Mul(toBig(a), toBig(b)))
+	case rationalLevel:
+		return normRat(new(big.Rat).Mul(toRat(a), toRat(b)))
+	case realLevel:
+		return Real(toFloat(a) * toFloat(b))
+	}
+	return normComplex(toComplex(a) * toComplex(b))
+}
+
+// errDivByZero is returned when dividing an exact number by zero
+var errDivByZero = &ErrorObject{Message: "division by zero"}
+
+// div divides a by b, division of exact numbers is exact. e.g. (/ 1 3) → 1/3
+func div(a, b Number) (Number, error) {
+	switch max(level(a), level(b)) {
+	case realLevel:
+		return Real(toFloat(a) / toFloat(b)), nil
+	case complexLevel:
+		return normComplex(toComplex(a) / toComplex(b)), nil
+	}
+
+	if isZero(b) {
+		return nil, errDivByZero
+	}
+	return normRat(new(big.Rat).Quo(toRat(a), toRat(b))), nil
+}
+
+// remainder returns the remainder of a divided by b, with the sign of a
+func remainder(a, b Number) (Number, error) {
+	switch max(level(a), level(b)) {
+	case realLevel:
+		return Real(math.Mod(toFloat(a), toFloat(b))), nil
+	case complexLevel:
+		return nil, fmt.Errorf("can't divide complex numbers with remainder")
+	}
+
+	if isZero(b) {
+		return nil, errDivByZero
+	}
+
+	switch max(level(a), level(b)) {
+	case integerLevel:
+		if x, y := a.(Integer), b.(Integer); y != -1 { // MinInt64 % -1 overflows
+			return x % y, nil
+		}
+	case rationalLevel: // a - b*truncate(a/b)
+		q := new(big.Rat).Quo(toRat(a), toRat(b))
+		t := new(big.Int).Quo(q.Num(), q.Denom())
+		r := new(big.Rat).Mul(toRat(b), new(big.Rat).SetInt(t))
+		return normRat(r.Sub(toRat(a), r)), nil
+	}
+	return normBig(new(big.Int).Rem(toBig(a), toBig(b))), nil
+}
+
+// compare returns -1 if a < b, 0 if a == b and 1 if a > b. a and b must be
+// real numbers.
+func compare(a, b Number) int {
+	switch max(level(a), level(b)) {
+	case integerLevel:
+		x, y := a.(Integer), b.(Integer)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case bigLevel:
+		return toBig(a).Cmp(toBig(b))
+	case rationalLevel:
+		return toRat(a).Cmp(toRat(b))
+	}
+
+	x, y := toFloat(a), toFloat(b)
+	if a.IsExact() != b.IsExact() && !math.IsNaN(x) && !math.IsNaN(y) {
+		// Mixed exactness is compared exactly, big exact numbers can overflow
+		// a float or lose precision. e.g. (= (expt 2 70) (+ (expt 2 70) 1.))
+		switch {
+		case math.IsInf(x, 0) && !a.IsExact():
+			return int(math.Copysign(1, x))
+		case math.IsInf(y, 0) && !b.IsExact():
+			return -int(math.Copysign(1, y))
+		}
+		ea, _ := toExact(a)
+		eb, _ := toExact(b)
+		return toRat(ea).Cmp(toRat(eb))
+	}
+
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func isZero(n Number) bool {
+	switch n := n.(type) {
+	case Integer:
+		return n == 0
+	case BigInt:
+		return n.Sign() == 0
+	case Rational:
+		return n.Sign() == 0
+	case Complex:
+		return n == 0
+	}
+	return toFloat(n) == 0
+}
+
+// isReal returns true if n is not complex
+func isReal(n Number) bool {
+	_, ok := n.(Complex)
+	return !ok
+}
+
+// isInteger returns true if n is an integer (exact or inexact)
+func isInteger(n Number) bool {
+	switch n.(type) {
+	case Integer, BigInt:
+		return true
+	case Real:
+		f := toFloat(n)
+		return f == math.Trunc(f) && !math.IsInf(f, 0)
+	}
+	return false
+}
+
+// numEqv returns true if a and b are equal numbers with the same exactness
+func numEqv(a, b Number) bool {
+	if a.IsExact() != b.IsExact() {
+		return false
+	}
+
+	if !isReal(a) || !isReal(b) {
+		return toComplex(a) == toComplex(b)
+	}
+
+	if x, y := toFloat(a), toFloat(b); math.IsNaN(x) || math.IsNaN(y) {
+		return math.IsNaN(x) && math.IsNaN(y)
+	}
+	return compare(a, b) == 0
+}
+
+// toExact converts n to an exact number
+func toExact(n Number) (Number, error) {
+	if n.IsExact() {
+		return n, nil
+	}
+
+	if !isReal(n) {
+		return nil, fmt.Errorf("can't convert %v to exact", n)
+	}
+
+	f := toFloat(n)
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, fmt.Errorf("can't convert %v to exact", n)
+	}
+	return normRat(new(big.Rat).SetFloat64(f)), nil
+}
+
+// toInexact converts n to an inexact number
+func toInexact(n Number) Number {
+	if !isReal(n) {
+		return n
+	}
+	return Real(toFloat(n))
+}
+
+// rationalize returns the simplest rational within y of x
+func rationalize(x, y Number) (Number, error) {
+	if !isReal(x) || !isReal(y) {
+		return nil, fmt.Errorf("rationalize needs real numbers")
+	}
+
+	exact := x.IsExact() && y.IsExact()
+	ex, err := toExact(x)
+	if err != nil {
+		return nil, err
+	}
+	ey, err := toExact(y)
+	if err != nil {
+		return nil, err
+	}
+
+	d := new(big.Rat).Abs(toRat(ey))
+	lo := new(big.Rat).Sub(toRat(ex), d)
+	hi := new(big.Rat).Add(toRat(ex), d)
+	r := normRat(simplest(lo, hi))
+	if !exact {
+		return toInexact(r), nil
+	}
+	return r, nil
+}
+
+// simplest returns the simplest rational in [lo, hi]
+func simplest(lo, hi *big.Rat) *big.Rat {
+	switch {
+	case lo.Sign() > 0:
+		return simplestPositive(lo, hi)
+	case hi.Sign() < 0:
+		neg := simplestPositive(new(big.Rat).Neg(hi), new(big.Rat).Neg(lo))
+		return neg.Neg(neg)
+	}
+	return new(big.Rat) // 0 is in range
+}
+
+// simplestPositive returns the simplest rational in [lo, hi], 0 < lo <= hi
+// using continued fractions
+func simplestPositive(lo, hi *big.Rat) *big.Rat {
+	fl := floorRat(lo)
+	if new(big.Rat).SetInt(fl).Cmp(lo) == 0 {
+		return new(big.Rat).SetInt(fl)
+	}
+
+	if fl.Cmp(floorRat(hi)) < 0 { // an integer between lo & hi
+		return new(big.Rat).SetInt(fl.Add(fl, big.NewInt(1)))
+	}
+
+	// lo = fl + 1/a, hi = fl + 1/b
+	flr := new(big.Rat).SetInt(fl)
+	a := new(big.Rat).Inv(new(big.Rat).Sub(hi, flr))
+	b := new(big.Rat).Inv(new(big.Rat).Sub(lo, flr))
+	r := simplestPositive(a, b)
+	return r.Add(flr, r.Inv(r))
+}
+
+func floorRat(r *big.Rat) *big.Int {
+	q, _ := new(big.Int).DivMod(r.Num(), r.Denom(), new(big.Int))
+	return q
+}
+
+// realArg returns argument i as a real number
+func realArg(args []Object, i int) (Number, error) {
+	n, ok := args[i].(Number)
+	if !ok || !isReal(n) {
+		return nil, argError(args, i)
+	}
+	return n, nil
+}
+
+// rationalArg returns argument i as big.Rat and whether it was exact
+func rationalArg(args []Object, i int) (*big.Rat, bool, error) {
+	n, err := realArg(args, i)
+	if err != nil {
+		return nil, false, err
+	}
+
+	e, err := toExact(n)
+	if err != nil {
+		return nil, false, err
+	}
+	return toRat(e), n.IsExact(), nil
+}
+
+// radixArg returns optional argument i as a radix, the default is 10
+func radixArg(args []Object, i int) (int, error) {
+	if i >= len(args) {
+		return 10, nil
+	}
+
+	radix, err := intArg(args, i)
+	if err != nil {
+		return 0, err
+	}
+
+	switch radix {
+	case 2, 8, 10, 16:
+		return radix, nil
+	}
+	return 0, fmt.Errorf("argument %d: bad radix - %d", i, radix)
+}
+
+func init() {
+	m := map[Symbol]Object{
+		"exact?": &Function{"exact?", 1, 1, numeric(func(args []Number) (Object, error) {
+			return Boolean(args[0].IsExact()), nil
+		})},
+		"inexact?": &Function{"inexact?", 1, 1, numeric(func(args []Number) (Object, error) {
+			return Boolean(!args[0].IsExact()), nil
+		})},
+		"exact": &Function{"exact", 1, 1, numeric(func(args []Number) (Object, error) {
+			return toExact(args[0])
+		})},
+		"inexact": &Function{"inexact", 1, 1, numeric(func(args []Number) (Object, error) {
+			return toInexact(args[0]), nil
+		})},
+		"exact->inexact": &Function{"exact->inexact", 1, 1, numeric(func(args []Number) (Object, error) {
+			return toInexact(args[0]), nil
+		})},
+		"inexact->exact": &Function{"inexact->exact", 1, 1, numeric(func(args []Number) (Object, error) {
+			return toExact(args[0])
+		})},
+		"integer?": &Function{"integer?", 1, 1, func(args []Object) (Object, error) {
+			n, ok := args[0].(Number)
+			return Boolean(ok && isInteger(n)), nil
+		}},
+		"rational?": &Function{"rational?", 1, 1, func(args []Object) (Object, error) {
+			n, ok := args[0].(Number)
+			if !ok || !isReal(n) {
+				return Boolean(false), nil
+			}
+			f := toFloat(n)
+			return Boolean(!math.IsInf(f, 0) && !math.IsNaN(f)), nil
+		}},
+		"real?": &Function{"real?", 1, 1, func(args []Object) (Object, error) {
+			n, ok := args[0].(Number)
+			return Boolean(ok && isReal(n)), nil
+		}},
+		"complex?": &Function{"complex?", 1, 1, func(args []Object) (Object, error) {
+			_, ok := args[0].(Number)
+			return Boolean(ok), nil
+		}},
+		"numerator": &Function{"numerator", 1, 1, func(args []Object) (Object, error) {
+			r, exact, err := rationalArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			n := normBig(new(big.Int).Set(r.Num()))
+			if !exact {
+				return toInexact(n), nil
+			}
+			return n, nil
+		}},
+		"denominator": &Function{"denominator", 1, 1, func(args []Object) (Object, error) {
+			r, exact, err := rationalArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			n := normBig(new(big.Int).Set(r.Denom()))
+			if !exact {
+				return toInexact(n), nil
+			}
+			return n, nil
+		}},
+		// (rationalize 3/10 1/10) → 1/3
+		"rationalize": &Function{"rationalize", 2, 2, numeric(func(args []Number) (Object, error) {
+			return rationalize(args[0], args[1])
+		})},
+		"make-rectangular": &Function{"make-rectangular", 2, 2, func(args []Object) (Object, error) {
+			re, err := realArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			im, err := realArg(args, 1)
+			if err != nil {
+				return nil, err
+			}
+
+			if im.IsExact() && isZero(im) {
+				return re, nil
+			}
+			return normComplex(complex(toFloat(re), toFloat(im))), nil
+		}},
+		"make-polar": &Function{"make-polar", 2, 2, func(args []Object) (Object, error) {
+			r, err := realArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			theta, err := realArg(args, 1)
+			if err != nil {
+				return nil, err
+			}
+			return normComplex(cmplx.Rect(toFloat(r), toFloat(theta))), nil
+		}},
+		"real-part": &Function{"real-part", 1, 1, numeric(func(args []Number) (Object, error) {
+			if c, ok := args[0].(Complex); ok {
+				return Real(real(c)), nil
+			}
+			return args[0], nil
+		})},
+		"imag-part": &Function{"imag-part", 1, 1, numeric(func(args []Number) (Object, error) {
+			if c, ok := args[0].(Complex); ok {
+				return Real(imag(c)), nil
+			}
+			return Integer(0), nil
+		})},
+		"magnitude": &Function{"magnitude", 1, 1, numeric(func(args []Number) (Object, error) {
+			if c, ok := args[0].(Complex); ok {
+				return Real(cmplx.Abs(complex128(c))), nil
+			}
+			if compare(args[0], Integer(0)) < 0 {
+				return sub(Integer(0), args[0]), nil
+			}
+			return args[0], nil
+		})},
+		"angle": &Function{"angle", 1, 1, numeric(func(args []Number) (Object, error) {
+			if c, ok := args[0].(Complex); ok {
+				return Real(cmplx.Phase(complex128(c))), nil
+			}
+			if compare(args[0], Integer(0)) < 0 {
+				return Real(math.Pi), nil
+			}
+			if args[0].IsExact() {
+				return Integer(0), nil
+			}
+			return Real(0), nil
+		})},
+	}
+
+	for name, obj := range m {
+		builtins.Set(name, obj)
+	}
+}
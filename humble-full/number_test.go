@@ -0,0 +1,163 @@
+package humble
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+var numberTestCases = []struct {
+	code string
+	out  string
+}{
+	{"7", "7"},
+	{"-7", "-7"},
+	{"2.5", "2.5"},
+	{"2.0", "2.0"},
+	{"(+ 1 2)", "3"},
+	{"(+ 1 2.0)", "3.0"},
+	{"(* 2 0.5)", "1.0"},
+	{"(/ 6 3)", "2"},
+	{"(/ 7 2)", "7/2"},
+	{"(/ 7 2.0)", "3.5"},
+	{"(% 7 2)", "1"},
+	{"(% -7 2)", "-1"},
+	{"(% 7.5 2)", "1.5"},
+	{"(- 5 7)", "-2"},
+	// Overflow to bignums
+	{"(+ 9223372036854775807 1)", "9223372036854775808"},
+	{"(- -9223372036854775808 1)", "-9223372036854775809"},
+	{"(* 4294967296 4294967296)", "18446744073709551616"},
+	{"(* -1 -9223372036854775808)", "9223372036854775808"},
+	{"(- 9223372036854775808 1)", "9223372036854775807"},
+	{"123456789012345678901234567890", "123456789012345678901234567890"},
+	{"(% 123456789012345678901234567891 7)", "1"},
+	{"(/ 123456789012345678901234567890 10)", "12345678901234567890123456789"},
+	{"(< 9223372036854775807 9223372036854775808)", "#t"},
+	{"(define (fact n) (if (< n 2) 1 (* n (fact (- n 1))))) (fact 25)", "15511210043330985984000000"},
+	// Exactness
+	{"(eqv? 2 2.0)", "#f"},
+	{"(eqv? 2 2)", "#t"},
+	{"(eqv? 9223372036854775808 9223372036854775808)", "#t"},
+	{"(equal? '(1 2) (list 1 2))", "#t"},
+	{"(case 9223372036854775808 ((9223372036854775808) 'big) (else 'other))", "big"},
+	// Rationals
+	{"1/3", "1/3"},
+	{"6/4", "3/2"},
+	{"-4/2", "-2"},
+	{"(+ 1/3 2/3)", "1"},
+	{"(* 1/2 0.5)", "0.25"},
+	{"(- 1/2 1)", "-1/2"},
+	{"(% 7/2 1)", "1/2"},
+	{"(< 1/3 0.34)", "#t"},
+	{"(eqv? 1/2 2/4)", "#t"},
+	{"(exact 0.5)", "1/2"},
+	{"(inexact 1/4)", "0.25"},
+	{"(exact->inexact 1/2)", "0.5"},
+	{"(inexact->exact 2.0)", "2"},
+	{"(exact? 1/2)", "#t"},
+	{"(inexact? 1/2)", "#f"},
+	{"(numerator 6/4)", "3"},
+	{"(denominator 6/4)", "2"},
+	{"(denominator 0.5)", "2.0"},
+	{"(rationalize 3/10 1/10)", "1/3"},
+	{"(rationalize -3/10 1/10)", "-1/3"},
+	{"(rationalize 0.3 1/10)", "0.3333333333333333"},
+	{"(rational? 1/2)", "#t"},
+	{"(integer? 2.0)", "#t"},
+	{"(integer? 1/2)", "#f"},
+	// Complex
+	{"1+2i", "1.0+2.0i"},
+	{"-i", "0.0-1.0i"},
+	{"1e3-2.5i", "1000.0-2.5i"},
+	{"(+ 1+i 1-i)", "2.0"},
+	{"(* 1+2i 1+2i)", "-3.0+4.0i"},
+	{"(make-rectangular 1 2)", "1.0+2.0i"},
+	{"(make-rectangular 1 0)", "1"},
+	{"(magnitude 3+4i)", "5.0"},
+	{"(magnitude -5/2)", "5/2"},
+	{"(real-part 1+2i)", "1.0"},
+	{"(imag-part 3)", "0"},
+	{"(real? 1+2i)", "#f"},
+	{"(complex? 1)", "#t"},
+	// Literals
+	{"#x1F", "31"},
+	{"#XfF", "255"},
+	{"#b-1010", "-10"},
+	{"#o17", "15"},
+	{"#d10", "10"},
+	{"#x10/4", "4"},
+	{"#e1.5", "3/2"},
+	{"#e0.1", "1/10"},
+	{"#i1/4", "0.25"},
+	{"#x#e1F", "31"},
+	{"#e#x10", "16"},
+	{".5", "0.5"},
+	{"-1.", "-1.0"},
+	{"1e400", "+inf.0"},
+	{"+inf.0", "+inf.0"},
+	{"-inf.0", "-inf.0"},
+	{"+nan.0", "+nan.0"},
+	{"(- 0 +inf.0)", "-inf.0"},
+	{"(eqv? +nan.0 +nan.0)", "#t"},
+	{"(eqv? +nan.0 1.0)", "#f"},
+	{"(< +nan.0 1)", "#f"},
+	{"+i", "0.0+1.0i"},
+	{"1+inf.0i", "1.0+inf.0i"},
+	{"1@0", "1"},
+	{"'Inf", "Inf"},
+	{"'...", "..."},
+	{`(string->number "12")`, "12"},
+	{`(string->number "ff" 16)`, "255"},
+	{`(string->number "#b101")`, "5"},
+	{`(string->number "1_000")`, "#f"},
+	{`(string->number "Inf")`, "#f"},
+	{`(number->string 2.0)`, `"2.0"`},
+}
+
+func TestNumbers(t *testing.T) {
+	for _, tc := range numberTestCases {
+		t.Run(tc.code, func(t *testing.T) {
+			out := fmt.Sprint(run(t, New(), tc.code))
+			if tc.out != out {
+				t.Fatalf("result mismatch: %s != %s", tc.out, out)
+			}
+		})
+	}
+}
+
+var numberErrorTestCases = []errorTestCase{
+	{"(/ 1 0)", "<test>:1:1: / - division by zero"},
+	{"(+ 1\n  (/ 1 0))", "<test>:2:3: / - division by zero"},
+	{"(< 1+i 2)", "<test>:1:1: < - argument 0: got 1.0+1.0i of type humble.Complex"},
+	{"(exact 1+i)", "<test>:1:1: exact - can't convert 1.0+1.0i to exact"},
+	{"1_000", "<test>:1:1: bad number literal - 1_000"},
+	{"#x1.5", "<test>:1:1: bad number literal - #x1.5"},
+	{"#x#x1", "<test>:1:1: bad number literal - #x#x1"},
+	{`(string->number "1" 3)`, "<test>:1:1: string->number - argument 1: bad radix - 3"},
+	{"(list-ref '(a b) 1.0)", "<test>:1:1: list-ref - argument 1: 1.0 is not an exact integer"},
+}
+
+func TestNumberErrors(t *testing.T) {
+	testErrors(t, numberErrorTestCases)
+}
+
+func TestBigIntGo(t *testing.T) {
+	interp := New()
+	err := interp.Register("big-square", func(n *big.Int) *big.Int {
+		return new(big.Int).Mul(n, n)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := interp.Eval("(list (big-square 3) (big-square 9223372036854775808))")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "(9 85070591730234615865843651857942052864)"
+	if s := fmt.Sprint(out); s != expected {
+		t.Fatalf("result mismatch: %s != %s", expected, s)
+	}
+}
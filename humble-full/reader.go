@@ -0,0 +1,639 @@
+package humble
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"math/cmplx"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TokenKind is the kind of token
+type TokenKind int
+
+// Token kinds
+const (
+	AtomToken   TokenKind = iota // number or symbol
+	OpenToken                    // (
+	CloseToken                   // )
+	StringToken                  // "hello", Text is without quotes and escapes
+	QuoteToken                   // ' ` , ,@
+	VectorToken                  // #( #u8(
+)
+
+// quoteNames are the names of the forms quote tokens stands for. e.g. 'x → (quote x)
+var quoteNames = map[string]Symbol{
+	"'":  "quote",
+	"`":  "quasiquote",
+	",":  "unquote",
+	",@": "unquote-splicing",
+}
+
+// Token in the language
+type Token struct {
+	Kind TokenKind
+	Text string
+	Pos  Position
+}
+
+func (t Token) String() string {
+	return t.Text
+}
+
+// Lexer reads tokens from an io.Reader, one rune at a time
+type Lexer struct {
+	r       io.RuneScanner
+	pos     Position // position of next rune
+	prevPos Position // position before last ReadRune, used by UnreadRune
+}
+
+// NewLexer returns a new lexer reading code of fileName from r
+func NewLexer(r io.Reader, fileName string) *Lexer {
+	rs, ok := r.(io.RuneScanner)
+	if !ok {
+		rs = bufio.NewReader(r)
+	}
+
+	return &Lexer{
+		r:   rs,
+		pos: Position{fileName, 1, 1},
+	}
+}
+
+func (l *Lexer) readRune() (rune, error) {
+	r, _, err := l.r.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+
+	l.prevPos = l.pos
+	if r == '\n' {
+		l.pos.Line++
+		l.pos.Col = 1
+	} else {
+		l.pos.Col++
+	}
+	return r, nil
+}
+
+func (l *Lexer) unreadRune() error {
+	if err := l.r.UnreadRune(); err != nil {
+		return err
+	}
+	l.pos = l.prevPos
+	return nil
+}
+
+// Next returns the next token, it returns io.EOF at end of input
+func (l *Lexer) Next() (Token, error) {
+	// Skip whitespace & comments
+	for {
+		r, err := l.readRune()
+		if err != nil {
+			return Token{}, err
+		}
+
+		if r == ';' {
+			if err := l.skipLine(); err != nil {
+				return Token{}, err
+			}
+			continue
+		}
+
+		if !unicode.IsSpace(r) {
+			if err := l.unreadRune(); err != nil {
+				return Token{}, err
+			}
+			break
+		}
+	}
+
+	start := l.pos
+	r, err := l.readRune()
+	if err != nil {
+		return Token{}, err
+	}
+
+	switch r {
+	case '(':
+		return Token{OpenToken, "(", start}, nil
+	case ')':
+		return Token{CloseToken, ")", start}, nil
+	case '\'', '`':
+		return Token{QuoteToken, string(r), start}, nil
+	case ',':
+		next, err := l.readRune()
+		if err == nil && next == '@' {
+			return Token{QuoteToken, ",@", start}, nil
+		}
+		if err == nil {
+			if err := l.unreadRune(); err != nil {
+				return Token{}, err
+			}
+		}
+		return Token{QuoteToken, ",", start}, nil
+	case '"':
+		return l.readString(start)
+	}
+
+	var buf strings.Builder
+	buf.WriteRune(r)
+	for {
+		r, err := l.readRune()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Token{}, err
+		}
+
+		if isDelimiter(r) {
+			if err := l.unreadRune(); err != nil {
+				return Token{}, err
+			}
+			break
+		}
+		buf.WriteRune(r)
+	}
+
+	if text := buf.String(); text == "#" || text == "#u8" { // vector start?
+		r, err := l.readRune()
+		if err == nil && r == '(' {
+			return Token{VectorToken, text + "(", start}, nil
+		}
+		if err == nil {
+			if err := l.unreadRune(); err != nil {
+				return Token{}, err
+			}
+		}
+	}
+
+	return Token{AtomToken, buf.String(), start}, nil
+}
+
+// readString reads a string literal starting at start, after the opening '"'
+func (l *Lexer) readString(start Position) (Token, error) {
+	var buf strings.Builder
+	for {
+		r, err := l.readRune()
+		if err == io.EOF {
+			return Token{}, errorAt(start, "unterminated string")
+		}
+		if err != nil {
+			return Token{}, err
+		}
+
+		switch r {
+		case '"':
+			return Token{StringToken, buf.String(), start}, nil
+		case '\\':
+			r, err = l.readEscape()
+			if err != nil {
+				return Token{}, err
+			}
+		}
+		buf.WriteRune(r)
+	}
+}
+
+// readEscape reads an escape sequence after '\\'. e.g. \n, \x41;
+func (l *Lexer) readEscape() (rune, error) {
+	pos := l.prevPos
+	r, err := l.readRune()
+	if err == io.EOF {
+		return 0, errorAt(pos, "unterminated string")
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	switch r {
+	case 'n':
+		return '\n', nil
+	case 't':
+		return '\t', nil
+	case '"', '\\':
+		return r, nil
+	case 'x':
+		var hex strings.Builder
+		for {
+			r, err := l.readRune()
+			if err != nil || r == '"' {
+				return 0, errorAt(pos, "unterminated hex escape")
+			}
+			if r == ';' {
+				break
+			}
+			hex.WriteRune(r)
+		}
+
+		n, err := strconv.ParseUint(hex.String(), 16, 32)
+		if err != nil || !utf8.ValidRune(rune(n)) {
+			return 0, errorAt(pos, "bad hex escape - %q", hex.String())
+		}
+		return rune(n), nil
+	}
+
+	return 0, errorAt(pos, "unknown escape - \\%c", r)
+}
+
+// skipLine skips until end of line (used for comments)
+func (l *Lexer) skipLine() error {
+	for {
+		r, err := l.readRune()
+		if err != nil {
+			return err
+		}
+		if r == '\n' {
+			return nil
+		}
+	}
+}
+
+func isDelimiter(r rune) bool {
+	return r == '(' || r == ')' || r == ';' || r == '"' || unicode.IsSpace(r)
+}
+
+// Reader reads expressions from an io.Reader, one at a time
+type Reader struct {
+	lex   *Lexer
+	depth int // number of open '(' in current expression
+}
+
+// NewReader returns a new reader reading code of fileName from r
+func NewReader(r io.Reader, fileName string) *Reader {
+	return &Reader{lex: NewLexer(r, fileName)}
+}
+
+// Depth returns the nesting depth of the expression currently being read, it
+// is 0 between expressions
+func (r *Reader) Depth() int {
+	return r.depth
+}
+
+// SkipLine skips the rest of the current line
+func (r *Reader) SkipLine() error {
+	r.depth = 0
+	return r.lex.skipLine()
+}
+
+// Read reads the next expression, it returns io.EOF at end of input
+func (r *Reader) Read() (Expression, error) {
+	tok, err := r.lex.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.readExpr(tok)
+}
+
+// readExpr reads an expression starting with tok
+func (r *Reader) readExpr(tok Token) (Expression, error) {
+	switch tok.Kind {
+	case OpenToken:
+		r.depth++
+		defer func() { r.depth-- }()
+
+		list := ListExpr{pos: tok.Pos}
+		for {
+			next, err := r.next(tok)
+			if err != nil {
+				return nil, err
+			}
+
+			if next.Kind == CloseToken {
+				return list, nil
+			}
+
+			if next.Kind == AtomToken && next.Text == "." { // (a . b)
+				if len(list.Items) == 0 {
+					return nil, errorAt(next.Pos, "bad dotted list")
+				}
+
+				if list.Tail, err = r.readNext(tok); err != nil {
+					return nil, err
+				}
+
+				if next, err = r.next(tok); err != nil {
+					return nil, err
+				}
+				if next.Kind != CloseToken {
+					return nil, errorAt(next.Pos, "bad dotted list")
+				}
+				return list, nil
+			}
+
+			child, err := r.readExpr(next)
+			if err != nil {
+				return nil, err
+			}
+			list.Items = append(list.Items, child)
+		}
+	case VectorToken:
+		return r.readVector(tok)
+	case QuoteToken: // 'x → (quote x)
+		expr, err := r.readNext(tok)
+		if err != nil {
+			return nil, err
+		}
+		quote := SymbolExpr{Name: quoteNames[tok.Text], pos: tok.Pos}
+		return ListExpr{Items: []Expression{quote, expr}, pos: tok.Pos}, nil
+	case CloseToken:
+		return nil, errorAt(tok.Pos, "unexpected ')' without matching '('")
+	case StringToken:
+		return StringExpr{String(tok.Text), tok.Pos}, nil
+	}
+
+	switch tok.Text {
+	case "#t", "#true":
+		return BooleanExpr{true, tok.Pos}, nil
+	case "#f", "#false":
+		return BooleanExpr{false, tok.Pos}, nil
+	}
+
+	if name, ok := strings.CutPrefix(tok.Text, "#:"); ok && name != "" {
+		return KeywordExpr{Keyword(name), tok.Pos}, nil
+	}
+
+	if val, ok := parseNumber(tok.Text, 10); ok {
+		return NumberExpr{val, tok.Pos}, nil
+	}
+
+	if isNumeric(tok.Text) {
+		return nil, errorAt(tok.Pos, "bad number literal - %s", tok.Text)
+	}
+	return SymbolExpr{Name: Symbol(tok.Text), pos: tok.Pos}, nil // name
+}
+
+// readVector reads a vector or bytevector literal starting with tok
+func (r *Reader) readVector(tok Token) (Expression, error) {
+	r.depth++
+	defer func() { r.depth-- }()
+
+	var items []Expression
+	for {
+		next, err := r.next(tok)
+		if err != nil {
+			return nil, err
+		}
+
+		if next.Kind == CloseToken {
+			break
+		}
+		if next.Kind == AtomToken && next.Text == "." {
+			return nil, errorAt(next.Pos, "bad vector literal")
+		}
+
+		item, err := r.readExpr(next)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	if tok.Text == "#(" {
+		return VectorExpr{items, tok.Pos}, nil
+	}
+
+	data := make([]byte, len(items))
+	for i, item := range items {
+		n, ok := item.(NumberExpr)
+		b, isInt := n.Value.(Integer)
+		if !ok || !isInt || b < 0 || b > 255 {
+			return nil, errorAt(item.Pos(), "bad bytevector item - %v", item)
+		}
+		data[i] = byte(b)
+	}
+	return BytevectorExpr{data, tok.Pos}, nil
+}
+
+// next returns the next token in an expression starting with start
+func (r *Reader) next(start Token) (Token, error) {
+	tok, err := r.lex.Next()
+	if err == io.EOF {
+		return Token{}, errorAt(start.Pos, "unbalanced expression")
+	}
+	return tok, err
+}
+
+// readNext reads the next expression inside an expression starting with start
+func (r *Reader) readNext(start Token) (Expression, error) {
+	tok, err := r.next(start)
+	if err != nil {
+		return nil, err
+	}
+
+	if tok.Kind == CloseToken {
+		return nil, errorAt(tok.Pos, "unexpected ')'")
+	}
+	return r.readExpr(tok)
+}
+
+// parseNumber parses a number literal in radix (unless it has a radix prefix).
+// Integers and fractions (e.g. 1/3) are exact, other numbers are inexact.
+// Literals can have radix (#x, #b, #o, #d) and exactness (#e, #i) prefixes.
+// e.g. #xFF, #e1.5, -2/3, +inf.0, 1+2i, 1@0
+func parseNumber(lit string, radix int) (Number, bool) {
+	var exactness, prefixRadix byte
+	for len(lit) >= 2 && lit[0] == '#' {
+		switch c := lit[1] | 0x20; c { // lower case
+		case 'e', 'i':
+			if exactness != 0 {
+				return nil, false
+			}
+			exactness = c
+		case 'x', 'b', 'o', 'd':
+			if prefixRadix != 0 {
+				return nil, false
+			}
+			prefixRadix = c
+			radix = map[byte]int{'x': 16, 'b': 2, 'o': 8, 'd': 10}[c]
+		default:
+			return nil, false
+		}
+		lit = lit[2:]
+	}
+
+	n, ok := parseComplex(lit, radix, exactness == 'e')
+	if !ok {
+		return nil, false
+	}
+
+	switch exactness {
+	case 'e':
+		e, err := toExact(n)
+		if err != nil {
+			return nil, false
+		}
+		return e, true
+	case 'i':
+		return toInexact(n), true
+	}
+	return n, true
+}
+
+// parseComplex parses a complex literal. e.g. 1+2i, -i, 1@2
+func parseComplex(lit string, radix int, exact bool) (Number, bool) {
+	if mag, angle, ok := strings.Cut(lit, "@"); ok { // polar
+		r, ok := parseReal(mag, radix, exact)
+		if !ok {
+			return nil, false
+		}
+		theta, ok := parseReal(angle, radix, exact)
+		if !ok {
+			return nil, false
+		}
+
+		if theta.IsExact() && isZero(theta) {
+			return r, true
+		}
+		return normComplex(cmplx.Rect(toFloat(r), toFloat(theta))), true
+	}
+
+	lit, ok := strings.CutSuffix(lit, "i")
+	if !ok || lit == "" {
+		return parseReal(lit, radix, exact)
+	}
+
+	// Find the sign of the imaginary part, skipping exponent signs
+	i := len(lit) - 1
+	for ; i > 0; i-- {
+		if (lit[i] == '+' || lit[i] == '-') && !(radix == 10 && (lit[i-1]|0x20) == 'e') {
+			break
+		}
+	}
+
+	var re, im Number = Integer(0), Integer(1)
+	if i > 0 {
+		if re, ok = parseReal(lit[:i], radix, exact); !ok {
+			return nil, false
+		}
+	}
+
+	switch imLit := lit[i:]; imLit {
+	case "+":
+	case "-":
+		im = Integer(-1)
+	default:
+		if imLit[0] != '+' && imLit[0] != '-' {
+			return nil, false
+		}
+		if im, ok = parseReal(imLit, radix, exact); !ok {
+			return nil, false
+		}
+	}
+
+	if im.IsExact() && isZero(im) {
+		return re, true
+	}
+	return normComplex(complex(toFloat(re), toFloat(im))), true
+}
+
+// parseReal parses a real number literal. e.g. 12, -1/3, 2.5e3, +inf.0
+// If exact is true, decimals are parsed as exact rationals (e.g. #e0.1 → 1/10).
+func parseReal(lit string, radix int, exact bool) (Number, bool) {
+	switch lit {
+	case "+inf.0":
+		return Real(math.Inf(1)), true
+	case "-inf.0":
+		return Real(math.Inf(-1)), true
+	case "+nan.0", "-nan.0":
+		return Real(math.NaN()), true
+	}
+
+	if num, denom, ok := strings.Cut(lit, "/"); ok { // 1/3
+		if !isSignedDigits(num, radix) || !isDigits(denom, radix) {
+			return nil, false
+		}
+
+		n, _ := new(big.Int).SetString(num, radix)
+		d, _ := new(big.Int).SetString(denom, radix)
+		if d.Sign() == 0 {
+			return nil, false
+		}
+		return normRat(new(big.Rat).SetFrac(n, d)), true
+	}
+
+	if isSignedDigits(lit, radix) {
+		n, _ := new(big.Int).SetString(lit, radix)
+		return normBig(n), true
+	}
+
+	if radix != 10 || !isDecimal(lit) {
+		return nil, false
+	}
+
+	if exact {
+		r, ok := new(big.Rat).SetString(lit)
+		if !ok {
+			return nil, false
+		}
+		return normRat(r), true
+	}
+
+	f, err := strconv.ParseFloat(lit, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return nil, false
+	}
+	return Real(f), true
+}
+
+// isSignedDigits returns true if s is an optionally signed integer in radix
+func isSignedDigits(s string, radix int) bool {
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		s = s[1:]
+	}
+	return isDigits(s, radix)
+}
+
+// isDigits returns true if s is a non empty string of digits in radix
+func isDigits(s string, radix int) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, r := range s {
+		d := strings.IndexRune("0123456789abcdef", unicode.ToLower(r))
+		if d < 0 || d >= radix {
+			return false
+		}
+	}
+	return true
+}
+
+// isDecimal returns true if s is a decimal number. e.g. -1.5, .5, 1e10, 2.5E-3
+func isDecimal(s string) bool {
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		s = s[1:]
+	}
+
+	mantissa, exp, hasExp := strings.Cut(strings.ToLower(s), "e")
+	if hasExp && !isSignedDigits(exp, 10) {
+		return false
+	}
+
+	whole, frac, hasDot := strings.Cut(mantissa, ".")
+	if !hasDot {
+		return isDigits(whole, 10)
+	}
+	return (whole == "" || isDigits(whole, 10)) && (frac == "" || isDigits(frac, 10)) && whole+frac != ""
+}
+
+// isNumeric returns true if lit looks like a number literal, used to report bad
+// number literals instead of treating them as symbols. e.g. 1_000, #xZZ
+func isNumeric(lit string) bool {
+	if len(lit) >= 2 && lit[0] == '#' {
+		return strings.ContainsRune("eEiIxXbBoOdD", rune(lit[1]))
+	}
+
+	if lit != "" && (lit[0] == '+' || lit[0] == '-') {
+		lit = lit[1:]
+	}
+	lit = strings.TrimPrefix(lit, ".")
+	return lit != "" && lit[0] >= '0' && lit[0] <= '9'
+}
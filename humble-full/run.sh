@@ -1,3 +1,3 @@
 #!/bin/bash
 
-rlwrap go run humble.go
+rlwrap go run ./cmd/humble
@@ -0,0 +1,183 @@
+package humble
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// String is a string in the language
+type String string
+
+// String returns the string as a literal. e.g. "say \"hi\""
+func (s String) String() string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < ' ' || r == 0x7f {
+				fmt.Fprintf(&buf, `\x%x;`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+func init() {
+	m := map[Symbol]Object{
+		"string-length": &Function{"string-length", 1, 1, func(args []Object) (Object, error) {
+			s, err := stringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return Integer(utf8.RuneCountInString(string(s))), nil
+		}},
+		"string-append": &Function{"string-append", 0, -1, func(args []Object) (Object, error) {
+			var buf strings.Builder
+			for i := range args {
+				s, err := stringArg(args, i)
+				if err != nil {
+					return nil, err
+				}
+				buf.WriteString(string(s))
+			}
+			return String(buf.String()), nil
+		}},
+		// (substring s start [end]), indices are in characters
+		"substring": &Function{"substring", 2, 3, func(args []Object) (Object, error) {
+			s, err := stringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			runes := []rune(string(s))
+
+			start, err := intArg(args, 1)
+			if err != nil {
+				return nil, err
+			}
+
+			end := len(runes)
+			if len(args) == 3 {
+				if end, err = intArg(args, 2); err != nil {
+					return nil, err
+				}
+			}
+
+			if start < 0 || end > len(runes) || start > end {
+				return nil, fmt.Errorf("bad range [%d:%d] for string of length %d", start, end, len(runes))
+			}
+			return String(runes[start:end]), nil
+		}},
+		"string-upcase": &Function{"string-upcase", 1, 1, func(args []Object) (Object, error) {
+			s, err := stringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return String(strings.ToUpper(string(s))), nil
+		}},
+		"string-downcase": &Function{"string-downcase", 1, 1, func(args []Object) (Object, error) {
+			s, err := stringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return String(strings.ToLower(string(s))), nil
+		}},
+		// (string-index s sub) returns the character index of sub in s, or #f
+		"string-index": &Function{"string-index", 2, 2, func(args []Object) (Object, error) {
+			s, err := stringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			sub, err := stringArg(args, 1)
+			if err != nil {
+				return nil, err
+			}
+
+			i := strings.Index(string(s), string(sub))
+			if i == -1 {
+				return Boolean(false), nil
+			}
+			return Integer(utf8.RuneCountInString(string(s[:i]))), nil
+		}},
+		"string=?": &Function{"string=?", 2, 2, func(args []Object) (Object, error) {
+			a, b, err := stringArgs2(args)
+			if err != nil {
+				return nil, err
+			}
+			return Boolean(a == b), nil
+		}},
+		"string<?": &Function{"string<?", 2, 2, func(args []Object) (Object, error) {
+			a, b, err := stringArgs2(args)
+			if err != nil {
+				return nil, err
+			}
+			return Boolean(a < b), nil
+		}},
+		// (string->number "ff" 16) → 255
+		"string->number": &Function{"string->number", 1, 2, func(args []Object) (Object, error) {
+			s, err := stringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			radix, err := radixArg(args, 1)
+			if err != nil {
+				return nil, err
+			}
+
+			n, ok := parseNumber(string(s), radix)
+			if !ok {
+				return Boolean(false), nil
+			}
+			return n, nil
+		}},
+		// (number->string 255 16) → "ff"
+		"number->string": &Function{"number->string", 1, 2, func(args []Object) (Object, error) {
+			n, err := numberArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			radix, err := radixArg(args, 1)
+			if err != nil {
+				return nil, err
+			}
+
+			s, err := formatNumber(n, radix)
+			if err != nil {
+				return nil, err
+			}
+			return String(s), nil
+		}},
+	}
+
+	for name, obj := range m {
+		builtins.Set(name, obj)
+	}
+}
+
+func stringArgs2(args []Object) (String, String, error) {
+	a, err := stringArg(args, 0)
+	if err != nil {
+		return "", "", err
+	}
+
+	b, err := stringArg(args, 1)
+	if err != nil {
+		return "", "", err
+	}
+
+	return a, b, nil
+}
@@ -0,0 +1,473 @@
+package humble
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Vector is a fixed size array of objects. e.g. #(1 "a" b)
+type Vector struct {
+	Items []Object
+}
+
+func (v *Vector) String() string {
+	var buf bytes.Buffer
+	writeVector(&buf, v, make(map[Object]bool))
+	return buf.String()
+}
+
+// writeVector writes v to buf, see writeObject
+func writeVector(buf *bytes.Buffer, v *Vector, seen map[Object]bool) {
+	if seen[v] {
+		buf.WriteString("...")
+		return
+	}
+	seen[v] = true
+	defer delete(seen, v)
+
+	buf.WriteString("#(")
+	for i, item := range v.Items {
+		if i > 0 {
+			buf.WriteString(" ")
+		}
+		writeObject(buf, item, seen)
+	}
+	buf.WriteString(")")
+}
+
+// Bytevector is a fixed size array of bytes. e.g. #u8(1 255)
+type Bytevector struct {
+	Bytes []byte
+}
+
+func (v *Bytevector) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("#u8(")
+	for i, b := range v.Bytes {
+		if i > 0 {
+			buf.WriteString(" ")
+		}
+		fmt.Fprint(&buf, b)
+	}
+	buf.WriteString(")")
+	return buf.String()
+}
+
+// VectorExpr is a vector literal, items are not evaluated. e.g. #(1 (a b))
+type VectorExpr struct {
+	Items []Expression
+	pos   Position
+}
+
+func (e VectorExpr) String() string {
+	return toDatum(e).(*Vector).String()
+}
+
+// Pos returns the expression position
+func (e VectorExpr) Pos() Position {
+	return e.pos
+}
+
+// Eval returns a new vector with the literal items
+func (e VectorExpr) Eval(env *Environment) (Object, error) {
+	return toDatum(e), nil
+}
+
+// BytevectorExpr is a bytevector literal. e.g. #u8(1 2)
+type BytevectorExpr struct {
+	Value []byte
+	pos   Position
+}
+
+func (e BytevectorExpr) String() string {
+	return (&Bytevector{e.Value}).String()
+}
+
+// Pos returns the expression position
+func (e BytevectorExpr) Pos() Position {
+	return e.pos
+}
+
+// Eval returns a new bytevector with the literal bytes
+func (e BytevectorExpr) Eval(env *Environment) (Object, error) {
+	return toDatum(e), nil
+}
+
+func vectorArg(args []Object, i int) (*Vector, error) {
+	v, ok := args[i].(*Vector)
+	if !ok {
+		return nil, argError(args, i)
+	}
+	return v, nil
+}
+
+func bytevectorArg(args []Object, i int) (*Bytevector, error) {
+	v, ok := args[i].(*Bytevector)
+	if !ok {
+		return nil, argError(args, i)
+	}
+	return v, nil
+}
+
+// byteArg returns argument i as a byte, it must be an exact integer in [0, 255]
+func byteArg(args []Object, i int) (byte, error) {
+	n, err := intArg(args, i)
+	if err != nil {
+		return 0, err
+	}
+
+	if n < 0 || n > 255 {
+		return 0, fmt.Errorf("argument %d: %d is not a byte", i, n)
+	}
+	return byte(n), nil
+}
+
+// indexArg returns argument i as an index to a kind of length size
+func indexArg(args []Object, i int, size int, kind string) (int, error) {
+	idx, err := intArg(args, i)
+	if err != nil {
+		return 0, err
+	}
+
+	if idx < 0 || idx >= size {
+		return 0, fmt.Errorf("index %d out of range for %s of length %d", idx, kind, size)
+	}
+	return idx, nil
+}
+
+// rangeArgs returns the optional start & end arguments starting at argument i
+// for a kind of length size. e.g. (vector->list v 1 3)
+func rangeArgs(args []Object, i int, size int, kind string) (int, int, error) {
+	start, end := 0, size
+	var err error
+	if len(args) > i {
+		if start, err = intArg(args, i); err != nil {
+			return 0, 0, err
+		}
+	}
+	if len(args) > i+1 {
+		if end, err = intArg(args, i+1); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if start < 0 || end > size || start > end {
+		return 0, 0, fmt.Errorf("bad range [%d:%d] for %s of length %d", start, end, kind, size)
+	}
+	return start, end, nil
+}
+
+// maxSize is the maximal size of vectors created by make-vector &
+// make-bytevector
+const maxSize = 1 << 24
+
+// sizeArg returns argument i as a size for make-vector & make-bytevector
+func sizeArg(args []Object, i int) (int, error) {
+	n, err := intArg(args, i)
+	if err != nil {
+		return 0, err
+	}
+
+	if n < 0 {
+		return 0, fmt.Errorf("argument %d: negative size %d", i, n)
+	}
+	if n > maxSize {
+		return 0, fmt.Errorf("argument %d: size %d is too large", i, n)
+	}
+	return n, nil
+}
+
+// vectorsMap calls proc with the items of vectors at the same index, up to the
+// length of the shortest vector. Used by vector-map & vector-for-each.
+func vectorsMap(args []Object) ([]Object, error) {
+	proc, ok := args[0].(Callable)
+	if !ok {
+		return nil, argError(args, 0)
+	}
+
+	vecs := make([]*Vector, len(args)-1)
+	size := -1
+	for i := range vecs {
+		v, err := vectorArg(args, i+1)
+		if err != nil {
+			return nil, err
+		}
+		vecs[i] = v
+		if size == -1 || len(v.Items) < size {
+			size = len(v.Items)
+		}
+	}
+
+	out := make([]Object, size)
+	for i := range out {
+		procArgs := make([]Object, len(vecs))
+		for j, v := range vecs {
+			procArgs[j] = v.Items[i]
+		}
+
+		val, err := proc.Call(procArgs)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = val
+	}
+	return out, nil
+}
+
+func init() {
+	m := map[Symbol]Object{
+		"vector?": &Function{"vector?", 1, 1, func(args []Object) (Object, error) {
+			_, ok := args[0].(*Vector)
+			return Boolean(ok), nil
+		}},
+		// (make-vector 3 0) → #(0 0 0), fill defaults to #f
+		"make-vector": &Function{"make-vector", 1, 2, func(args []Object) (Object, error) {
+			n, err := sizeArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			var fill Object = Boolean(false)
+			if len(args) == 2 {
+				fill = args[1]
+			}
+
+			items := make([]Object, n)
+			for i := range items {
+				items[i] = fill
+			}
+			return &Vector{items}, nil
+		}},
+		"vector": &Function{"vector", 0, -1, func(args []Object) (Object, error) {
+			return &Vector{append([]Object(nil), args...)}, nil
+		}},
+		"vector-length": &Function{"vector-length", 1, 1, func(args []Object) (Object, error) {
+			v, err := vectorArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return Integer(len(v.Items)), nil
+		}},
+		"vector-ref": &Function{"vector-ref", 2, 2, func(args []Object) (Object, error) {
+			v, err := vectorArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			i, err := indexArg(args, 1, len(v.Items), "vector")
+			if err != nil {
+				return nil, err
+			}
+			return v.Items[i], nil
+		}},
+		"vector-set!": &Function{"vector-set!", 3, 3, func(args []Object) (Object, error) {
+			v, err := vectorArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			i, err := indexArg(args, 1, len(v.Items), "vector")
+			if err != nil {
+				return nil, err
+			}
+			v.Items[i] = args[2]
+			return v, nil
+		}},
+		// (vector-fill! v fill [start [end]])
+		"vector-fill!": &Function{"vector-fill!", 2, 4, func(args []Object) (Object, error) {
+			v, err := vectorArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			start, end, err := rangeArgs(args, 2, len(v.Items), "vector")
+			if err != nil {
+				return nil, err
+			}
+
+			for i := start; i < end; i++ {
+				v.Items[i] = args[1]
+			}
+			return v, nil
+		}},
+		// (vector-map + #(1 2) #(10 20)) → #(11 22)
+		"vector-map": &Function{"vector-map", 2, -1, func(args []Object) (Object, error) {
+			items, err := vectorsMap(args)
+			if err != nil {
+				return nil, err
+			}
+			return &Vector{items}, nil
+		}},
+		"vector-for-each": &Function{"vector-for-each", 2, -1, func(args []Object) (Object, error) {
+			if _, err := vectorsMap(args); err != nil {
+				return nil, err
+			}
+			return Boolean(false), nil
+		}},
+		// (vector->list v [start [end]])
+		"vector->list": &Function{"vector->list", 1, 3, func(args []Object) (Object, error) {
+			v, err := vectorArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			start, end, err := rangeArgs(args, 1, len(v.Items), "vector")
+			if err != nil {
+				return nil, err
+			}
+			return NewList(v.Items[start:end]...), nil
+		}},
+		"list->vector": &Function{"list->vector", 1, 1, func(args []Object) (Object, error) {
+			items, err := listArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return &Vector{items}, nil
+		}},
+		// (vector-copy v [start [end]])
+		"vector-copy": &Function{"vector-copy", 1, 3, func(args []Object) (Object, error) {
+			v, err := vectorArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			start, end, err := rangeArgs(args, 1, len(v.Items), "vector")
+			if err != nil {
+				return nil, err
+			}
+			return &Vector{append([]Object(nil), v.Items[start:end]...)}, nil
+		}},
+		"vector-append": &Function{"vector-append", 0, -1, func(args []Object) (Object, error) {
+			var items []Object
+			for i := range args {
+				v, err := vectorArg(args, i)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, v.Items...)
+			}
+			return &Vector{items}, nil
+		}},
+		"bytevector?": &Function{"bytevector?", 1, 1, func(args []Object) (Object, error) {
+			_, ok := args[0].(*Bytevector)
+			return Boolean(ok), nil
+		}},
+		// (make-bytevector 3 255) → #u8(255 255 255), fill defaults to 0
+		"make-bytevector": &Function{"make-bytevector", 1, 2, func(args []Object) (Object, error) {
+			n, err := sizeArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			var fill byte
+			if len(args) == 2 {
+				if fill, err = byteArg(args, 1); err != nil {
+					return nil, err
+				}
+			}
+			return &Bytevector{bytes.Repeat([]byte{fill}, n)}, nil
+		}},
+		"bytevector": &Function{"bytevector", 0, -1, func(args []Object) (Object, error) {
+			data := make([]byte, len(args))
+			for i := range args {
+				b, err := byteArg(args, i)
+				if err != nil {
+					return nil, err
+				}
+				data[i] = b
+			}
+			return &Bytevector{data}, nil
+		}},
+		"bytevector-length": &Function{"bytevector-length", 1, 1, func(args []Object) (Object, error) {
+			v, err := bytevectorArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return Integer(len(v.Bytes)), nil
+		}},
+		"bytevector-u8-ref": &Function{"bytevector-u8-ref", 2, 2, func(args []Object) (Object, error) {
+			v, err := bytevectorArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			i, err := indexArg(args, 1, len(v.Bytes), "bytevector")
+			if err != nil {
+				return nil, err
+			}
+			return Integer(v.Bytes[i]), nil
+		}},
+		"bytevector-u8-set!": &Function{"bytevector-u8-set!", 3, 3, func(args []Object) (Object, error) {
+			v, err := bytevectorArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			i, err := indexArg(args, 1, len(v.Bytes), "bytevector")
+			if err != nil {
+				return nil, err
+			}
+
+			b, err := byteArg(args, 2)
+			if err != nil {
+				return nil, err
+			}
+			v.Bytes[i] = b
+			return v, nil
+		}},
+		// (bytevector-copy v [start [end]])
+		"bytevector-copy": &Function{"bytevector-copy", 1, 3, func(args []Object) (Object, error) {
+			v, err := bytevectorArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			start, end, err := rangeArgs(args, 1, len(v.Bytes), "bytevector")
+			if err != nil {
+				return nil, err
+			}
+			return &Bytevector{bytes.Clone(v.Bytes[start:end])}, nil
+		}},
+		"bytevector-append": &Function{"bytevector-append", 0, -1, func(args []Object) (Object, error) {
+			var data []byte
+			for i := range args {
+				v, err := bytevectorArg(args, i)
+				if err != nil {
+					return nil, err
+				}
+				data = append(data, v.Bytes...)
+			}
+			return &Bytevector{data}, nil
+		}},
+		// (utf8->string v [start [end]])
+		"utf8->string": &Function{"utf8->string", 1, 3, func(args []Object) (Object, error) {
+			v, err := bytevectorArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			start, end, err := rangeArgs(args, 1, len(v.Bytes), "bytevector")
+			if err != nil {
+				return nil, err
+			}
+
+			data := v.Bytes[start:end]
+			if !utf8.Valid(data) {
+				return nil, fmt.Errorf("invalid UTF-8 in %v", &Bytevector{data})
+			}
+			return String(data), nil
+		}},
+		"string->utf8": &Function{"string->utf8", 1, 1, func(args []Object) (Object, error) {
+			s, err := stringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return &Bytevector{[]byte(s)}, nil
+		}},
+	}
+
+	for name, obj := range m {
+		builtins.Set(name, obj)
+	}
+}
@@ -0,0 +1,90 @@
+package humble
+
+import (
+	"fmt"
+	"testing"
+)
+
+var vectorTestCases = []struct {
+	code string
+	out  string
+}{
+	{"#(1 2 3)", "#(1 2 3)"},
+	{`#(1 (a b) "s" #(x))`, `#(1 (a b) "s" #(x))`},
+	{"'#(1 a)", "#(1 a)"},
+	{"#()", "#()"},
+	{"(vector? #(1))", "#t"},
+	{"(vector? '(1))", "#f"},
+	{"(vector 1 'a)", "#(1 a)"},
+	{"(make-vector 2)", "#(#f #f)"},
+	{"(make-vector 2 0)", "#(0 0)"},
+	{"(vector-length #(1 2))", "2"},
+	{"(vector-ref #(1 2 3) 1)", "2"},
+	{"(let ((v (make-vector 3 0))) (vector-set! v 0 'a) v)", "#(a 0 0)"},
+	{"(define v #(1 2)) (vector-set! v 0 9) v", "#(9 2)"},
+	{"(define (f) #(1 2)) (vector-set! (f) 0 9) (f)", "#(1 2)"},
+	{"(let ((v (vector 1 2 3 4))) (vector-fill! v 0) v)", "#(0 0 0 0)"},
+	{"(let ((v (vector 1 2 3 4))) (vector-fill! v 0 1 3) v)", "#(1 0 0 4)"},
+	{"(vector-map + #(1 2) #(10 20 30))", "#(11 22)"},
+	{"(let ((s 0)) (vector-for-each (lambda (x) (set! s (+ s x))) #(1 2 3)) s)", "6"},
+	{"(vector->list #(1 2 3))", "(1 2 3)"},
+	{"(vector->list #(1 2 3) 1)", "(2 3)"},
+	{"(list->vector '(1 2))", "#(1 2)"},
+	{"(vector-copy #(1 2 3) 1 2)", "#(2)"},
+	{"(vector-append #(1) #(2 3))", "#(1 2 3)"},
+	{"(equal? #(1 (2)) (vector 1 (list 2)))", "#t"},
+	{"(equal? #(1) #(1 2))", "#f"},
+	// Circular vectors
+	{"(define v (vector 1)) (vector-set! v 0 v) (equal? v v)", "#t"},
+	{"(define v (vector 1)) (vector-set! v 0 v) (define w (vector 1)) (vector-set! w 0 w) (equal? v w)", "#t"},
+	{"(define v (vector 1 2)) (vector-set! v 1 v) v", "#(1 ...)"},
+	{"(define v (vector 1)) (define p (list v)) (vector-set! v 0 p) p", "(#(...))"},
+	{"(eqv? #(1) #(1))", "#f"},
+	{"`#(1 ,(+ 1 1) ,@(list 3 4))", "#(1 2 3 4)"},
+	// Bytevectors
+	{"#u8(1 255 0)", "#u8(1 255 0)"},
+	{"(bytevector? #u8())", "#t"},
+	{"(bytevector 1 2 3)", "#u8(1 2 3)"},
+	{"(make-bytevector 2 7)", "#u8(7 7)"},
+	{"(bytevector-length #u8(1 2))", "2"},
+	{"(bytevector-u8-ref #u8(1 2) 1)", "2"},
+	{"(let ((b (make-bytevector 2 7))) (bytevector-u8-set! b 0 30) b)", "#u8(30 7)"},
+	{"(bytevector-copy #u8(1 2 3) 1)", "#u8(2 3)"},
+	{"(bytevector-append #u8(1) #u8(2))", "#u8(1 2)"},
+	{"(utf8->string #u8(104 105))", `"hi"`},
+	{`(string->utf8 "hé")`, "#u8(104 195 169)"},
+	{"(equal? #u8(1 2) (bytevector 1 2))", "#t"},
+}
+
+func TestVectors(t *testing.T) {
+	for _, tc := range vectorTestCases {
+		t.Run(tc.code, func(t *testing.T) {
+			out := fmt.Sprint(run(t, New(), tc.code))
+			if tc.out != out {
+				t.Fatalf("result mismatch: %s != %s", tc.out, out)
+			}
+		})
+	}
+}
+
+var vectorErrorTestCases = []errorTestCase{
+	{"(make-vector -1)", "<test>:1:1: make-vector - argument 0: negative size -1"},
+	{"(make-vector 100000000000000)", "<test>:1:1: make-vector - argument 0: size 100000000000000 is too large"},
+	{"(make-bytevector 100000000000000)", "<test>:1:1: make-bytevector - argument 0: size 100000000000000 is too large"},
+	{"(vector-ref #(1 2 3) 3)", "<test>:1:1: vector-ref - index 3 out of range for vector of length 3"},
+	{"(vector-ref #(1 2 3) -1)", "<test>:1:1: vector-ref - index -1 out of range for vector of length 3"},
+	{"(vector-ref #(1 2 3) 1.0)", "<test>:1:1: vector-ref - argument 1: 1.0 is not an exact integer"},
+	{"(vector-set! (vector) 0 1)", "<test>:1:1: vector-set! - index 0 out of range for vector of length 0"},
+	{"(vector-map car #(1))", "<test>:1:1: vector-map - car - argument 0: got 1 of type humble.Integer"},
+	{"(vector->list #(1 2 3) 2 1)", "<test>:1:1: vector->list - bad range [2:1] for vector of length 3"},
+	{"(bytevector 256)", "<test>:1:1: bytevector - argument 0: 256 is not a byte"},
+	{"(bytevector-u8-ref #u8(1 2) 2)", "<test>:1:1: bytevector-u8-ref - index 2 out of range for bytevector of length 2"},
+	{"(bytevector-u8-set! (make-bytevector 1) 0 300)", "<test>:1:1: bytevector-u8-set! - argument 2: 300 is not a byte"},
+	{"(utf8->string #u8(255))", "<test>:1:1: utf8->string - invalid UTF-8 in #u8(255)"},
+	{"#u8(256)", "<test>:1:5: bad bytevector item - 256"},
+	{"#u8(a)", "<test>:1:5: bad bytevector item - a"},
+}
+
+func TestVectorErrors(t *testing.T) {
+	testErrors(t, vectorErrorTestCases)
+}